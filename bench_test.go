@@ -2,6 +2,7 @@ package llsd
 
 import (
 	"compress/gzip"
+	"encoding/binary"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -74,6 +75,25 @@ func BenchmarkXMLMarshal(b *testing.B) {
 	b.SetBytes(int64(len(bytesLLSD)))
 }
 
+func BenchmarkXMLMarshalBinary(b *testing.B) {
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	for _, encoding := range []string{Base16, Base64, Base85} {
+		b.Run(encoding, func(b *testing.B) {
+			b.ReportAllocs()
+			enc := NewXMLEncoderWith(io.Discard, EncoderOptions{BinaryEncoding: encoding})
+			for i := 0; i < b.N; i++ {
+				if err := enc.Encode(data); err != nil {
+					b.Fatal("Encode: ", err)
+				}
+			}
+			b.SetBytes(int64(len(data)))
+		})
+	}
+}
+
 func BenchmarkXMLUnmarshal(b *testing.B) {
 	b.ReportAllocs()
 	if bytesLLSD == nil {
@@ -104,3 +124,32 @@ func BenchmarkUnmarshalString(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkBinaryScanBytes(b *testing.B) {
+	b.ReportAllocs()
+	binaryInit()
+	// Build an array of many copies of the basic document
+	const count = 1000
+	body := binaryBytes[len(BinaryHeader):]
+	data := []byte(BinaryHeader)
+	data = append(data, '[', 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], count)
+	for i := 0; i < count; i++ {
+		data = append(data, body...)
+	}
+	data = append(data, ']')
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	var scalar Scalar
+	for i := 0; i < b.N; i++ {
+		scanner := NewBinaryScannerBytes(data)
+		for {
+			if _, err := scanner.Next(&scalar); err != nil {
+				if err == io.EOF {
+					break
+				}
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package llsd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+var (
+	bigIntType   = reflect.TypeOf(big.Int{})
+	bigFloatType = reflect.TypeOf(big.Float{})
+)
+
+// bigAddr returns a pointer to v, copying it if v is not addressable.
+func bigAddr(v reflect.Value) any {
+	if v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p.Interface()
+}
+
+// marshalBig writes big.Int as integer when it fits in 32 bits and as 8-byte
+// binary when it fits in 64 bits, and big.Float as real. It reports whether v
+// was written.
+func (e *XMLEncoder) marshalBig(v reflect.Value) (bool, error) {
+	switch v.Type() {
+	case bigIntType:
+		i := bigAddr(v).(*big.Int)
+		if !i.IsInt64() {
+			return true, fmt.Errorf("LLSD: Cannot marshal big.Int %s, it overflows 64 bits", i)
+		}
+		n := i.Int64()
+		e.writeIndent()
+		if n >= math.MinInt32 && n <= math.MaxInt32 {
+			e.writeString(fmt.Sprintf("<integer>%d</integer>", n))
+			return true, nil
+		}
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(n))
+		e.writeString("<binary>")
+		if err := e.writeBytes(b, Base16); err != nil {
+			return true, err
+		}
+		e.writeString("</binary>")
+		return true, nil
+	case bigFloatType:
+		f := bigAddr(v).(*big.Float)
+		e.writeIndent()
+		e.writeString("<real>")
+		e.writeString(f.Text('g', -1))
+		e.writeString("</real>")
+		return true, nil
+	}
+	return false, nil
+}
+
+// big decodes integer, real, and 8-byte binary values into big.Int and
+// big.Float. It reports whether v was decoded.
+func (u *Unmarshaler) big(v reflect.Value, tok Scalar) (bool, error) {
+	if !v.CanAddr() {
+		return false, nil
+	}
+	switch v.Type() {
+	case bigIntType:
+		i := v.Addr().Interface().(*big.Int)
+		switch tok.Type {
+		case Integer:
+			n, err := u.integer(tok.Data)
+			if err != nil {
+				return true, err
+			}
+			i.SetInt64(n)
+		case Binary:
+			value, err := u.binary(tok, nil)
+			if err != nil {
+				return true, err
+			}
+			if len(value) < 8 {
+				return true, &UnmarshalTypeError{Value: "binary (too few bytes) " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+			}
+			i.SetInt64(int64(binary.BigEndian.Uint64(value[:8])))
+		default:
+			return true, &UnmarshalTypeError{Value: tok.Type.String() + " " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+		}
+		return true, nil
+	case bigFloatType:
+		f := v.Addr().Interface().(*big.Float)
+		switch {
+		case tok.Type == Real && u.text:
+			// Parse text directly to avoid losing precision
+			if len(tok.Data) == 0 {
+				f.SetFloat64(0)
+				return true, nil
+			}
+			if _, _, err := f.Parse(string(tok.Data), 10); err != nil {
+				return true, err
+			}
+		case tok.Type == Real:
+			value, err := u.dec.Real(tok.Data)
+			if err != nil {
+				return true, err
+			}
+			f.SetFloat64(value)
+		case tok.Type == Integer:
+			n, err := u.integer(tok.Data)
+			if err != nil {
+				return true, err
+			}
+			f.SetInt64(n)
+		default:
+			return true, &UnmarshalTypeError{Value: tok.Type.String() + " " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+		}
+		return true, nil
+	}
+	return false, nil
+}
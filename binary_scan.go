@@ -1,6 +1,7 @@
 package llsd
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -8,22 +9,57 @@ import (
 
 const BinaryHeader = "<?llsd/binary?>\n"
 
+// BinaryScanner reads tokens from binary LLSD. Strings, keys, and binary
+// values are prefixed by a uint32 size, limiting each to 4GB, while offsets
+// into the stream are int64 so documents may be larger.
 type BinaryScanner struct {
-	r   io.Reader
-	off int64
+	r    io.Reader
+	data []byte // backing input when scanning in-memory bytes
+	off  int64
 }
 
 func NewBinaryScanner(r io.Reader) *BinaryScanner {
 	return &BinaryScanner{r: r}
 }
 
+// NewBinaryScannerBytes creates a BinaryScanner reading directly from data,
+// such as a memory-mapped file. Scalar data is not copied: Scalar.Data aliases
+// data, so data must not be modified while tokens are in use. Token still
+// allocates to return scalars and keys; use Next to scan without allocating.
+func NewBinaryScannerBytes(data []byte) *BinaryScanner {
+	return &BinaryScanner{data: data}
+}
+
 func (s *BinaryScanner) Offset() int64 {
 	return s.off
 }
 
 func (s *BinaryScanner) Token() (Token, error) {
+	var scalar Scalar
+	tok, err := s.Next(&scalar)
+	switch tok.(type) {
+	case Scalar:
+		return scalar, err
+	case Key:
+		return Key(scalar.Data), err
+	}
+	return tok, err
+}
+
+var (
+	scalarToken Token = Scalar{}
+	keyToken    Token = Key("")
+	trueData          = []byte{1} // shared by boolean tokens, never modified
+)
+
+// Next reads the next token like Token, but stores scalars and keys in
+// scalar rather than returning them, so that scanning the input of
+// NewBinaryScannerBytes does not allocate. For a scalar, Next returns the zero
+// Scalar and for a key the empty Key, with the scalar or key bytes in
+// scalar.Data. Other tokens are returned as by Token.
+func (s *BinaryScanner) Next(scalar *Scalar) (Token, error) {
 	for {
-		op, err := s.read(1)
+		op, err := s.readOp()
 		if err != nil {
 			return nil, err
 		}
@@ -33,13 +69,16 @@ func (s *BinaryScanner) Token() (Token, error) {
 			if err != nil {
 				return nil, err
 			}
-			return Scalar{Type: Integer, Data: buf}, nil
+			*scalar = Scalar{Type: Integer, Data: buf}
+			return scalarToken, nil
 		case 'r':
 			buf, err := s.read(8)
-			return Scalar{Type: Real, Data: buf}, err
+			*scalar = Scalar{Type: Real, Data: buf}
+			return scalarToken, err
 		case 'u':
 			buf, err := s.read(16)
-			return Scalar{Type: UUIDType, Data: buf}, err
+			*scalar = Scalar{Type: UUIDType, Data: buf}
+			return scalarToken, err
 		case 'b':
 			buf, err := s.read(4)
 			if err != nil {
@@ -47,7 +86,8 @@ func (s *BinaryScanner) Token() (Token, error) {
 			}
 			size := binary.BigEndian.Uint32(buf)
 			buf, err = s.read(size)
-			return Scalar{Type: Binary, Data: buf}, err
+			*scalar = Scalar{Type: Binary, Data: buf}
+			return scalarToken, err
 		case 's':
 			buf, err := s.read(4)
 			if err != nil {
@@ -55,10 +95,21 @@ func (s *BinaryScanner) Token() (Token, error) {
 			}
 			size := binary.BigEndian.Uint32(buf)
 			buf, err = s.read(size)
-			return Scalar{Type: String, Data: buf}, err
-		case 'd':
+			*scalar = Scalar{Type: String, Data: buf}
+			return scalarToken, err
+		case 'l':
 			buf, err := s.read(4)
-			return Scalar{Type: Date, Data: buf}, err
+			if err != nil {
+				return nil, err
+			}
+			size := binary.BigEndian.Uint32(buf)
+			buf, err = s.read(size)
+			*scalar = Scalar{Type: URI, Data: buf}
+			return scalarToken, err
+		case 'd':
+			buf, err := s.read(8)
+			*scalar = Scalar{Type: Date, Data: buf}
+			return scalarToken, err
 		case 'k':
 			buf, err := s.read(4)
 			if err != nil {
@@ -66,7 +117,8 @@ func (s *BinaryScanner) Token() (Token, error) {
 			}
 			size := binary.BigEndian.Uint32(buf)
 			buf, err = s.read(size)
-			return Key(buf), err
+			*scalar = Scalar{Data: buf}
+			return keyToken, err
 		case '{':
 			// Eat map size, could use it to provide a skip() method
 			_, err := s.read(4)
@@ -80,11 +132,14 @@ func (s *BinaryScanner) Token() (Token, error) {
 		case ']':
 			return ArrayEnd{}, nil
 		case '1':
-			return Scalar{Type: Boolean, Data: []byte{1}}, nil
+			*scalar = Scalar{Type: Boolean, Data: trueData}
+			return scalarToken, nil
 		case '0':
-			return Scalar{Type: Boolean, Data: []byte{}}, nil
+			*scalar = Scalar{Type: Boolean, Data: trueData[:0]}
+			return scalarToken, nil
 		case '!':
-			return Scalar{Type: Undefined}, nil
+			*scalar = Scalar{Type: Undefined}
+			return scalarToken, nil
 		case '<':
 			// Read header
 			if s.off == 1 {
@@ -92,26 +147,114 @@ func (s *BinaryScanner) Token() (Token, error) {
 				if err != nil {
 					return nil, err
 				}
-				header := "<" + string(buf)
-				if header != BinaryHeader {
-					return nil, fmt.Errorf("Invalid LLSD: unrecognized header %s", header)
+				if string(buf) != BinaryHeader[1:] {
+					return nil, &InvalidLLSDError{Problem: fmt.Sprintf("unrecognized header <%s", buf), Offset: s.off}
 				}
 				continue
 			}
 			fallthrough
 		default:
-			return nil, fmt.Errorf("Invalid LLSD %s", op)
+			return nil, &InvalidLLSDError{Problem: fmt.Sprintf("unknown opcode %q", op[0]), Offset: s.off}
 		}
 
 	}
 }
 
+// maxChunk is the largest element read into a single allocation up front.
+// Larger elements are read incrementally so that a corrupt size prefix near
+// the 4GB limit fails on truncated input instead of allocating its full size.
+const maxChunk = 1 << 20
+
+// readOp reads the opcode of the next token, returning io.EOF at the end of
+// input.
+func (s *BinaryScanner) readOp() ([]byte, error) {
+	if s.data != nil {
+		return s.slice(1)
+	}
+	return s.readFull(1)
+}
+
+// read reads the num bytes of an element. Input ending before the element is
+// complete, even before its first byte, is invalid.
 func (s *BinaryScanner) read(num uint32) ([]byte, error) {
-	buf := make([]byte, num)
-	_, err := s.r.Read(buf)
-	s.off += int64(num)
-	if err != nil {
+	start := s.off
+	var buf []byte
+	var err error
+	if s.data != nil {
+		buf, err = s.slice(num)
+	} else {
+		buf, err = s.readFull(num)
+	}
+	if err == io.ErrUnexpectedEOF || err == io.EOF && num > 0 {
+		return buf, &InvalidLLSDError{Problem: fmt.Sprintf("element of %d bytes exceeds remaining input", num), Offset: start}
+	}
+	return buf, err
+}
+
+// readFull reads exactly num bytes from the underlying reader. Elements larger
+// than the known remaining input fail without being read.
+func (s *BinaryScanner) readFull(num uint32) ([]byte, error) {
+	if n, ok := s.remaining(num); ok && int64(num) > n {
+		if n == 0 {
+			return nil, io.EOF
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	if num <= maxChunk {
+		buf := make([]byte, num)
+		n, err := io.ReadFull(s.r, buf)
+		s.off += int64(n)
 		return buf, err
 	}
+	var b bytes.Buffer
+	n, err := io.CopyN(&b, s.r, int64(num))
+	s.off += n
+	if err == io.EOF && n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return b.Bytes(), err
+}
+
+// remaining reports the number of unread bytes of the underlying reader when
+// it can be known without reading, such as for a bytes.Reader. Seekable readers
+// are only measured for elements of more than maxChunk bytes, which would
+// otherwise be read incrementally until the end of input.
+func (s *BinaryScanner) remaining(num uint32) (int64, bool) {
+	switch r := s.r.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len()), true
+	case io.Seeker:
+		if num <= maxChunk {
+			return 0, false
+		}
+		cur, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, false
+		}
+		if _, err = r.Seek(cur, io.SeekStart); err != nil {
+			return 0, false
+		}
+		return end - cur, true
+	}
+	return 0, false
+}
+
+// slice returns the next num bytes of the backing input without copying.
+func (s *BinaryScanner) slice(num uint32) ([]byte, error) {
+	if num > 0 && s.off >= int64(len(s.data)) {
+		return nil, io.EOF
+	}
+	end := s.off + int64(num)
+	if end > int64(len(s.data)) {
+		buf := s.data[s.off:]
+		s.off = int64(len(s.data))
+		return buf, io.ErrUnexpectedEOF
+	}
+	buf := s.data[s.off:end:end]
+	s.off = end
 	return buf, nil
 }
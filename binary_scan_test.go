@@ -5,10 +5,16 @@ import (
 	"compress/gzip"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"io"
 	"math"
+	"net/url"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 var binaryBytes []byte
@@ -87,3 +93,296 @@ func TestBinaryBasicUnmarshal(t *testing.T) {
 		t.Fatalf("Expected dst.scale to equal \"%s\", got \"%s\"", "one minute", dst.Scale)
 	}
 }
+
+func TestBinaryUnmarshalDate(t *testing.T) {
+	expected := time.Date(2023, 4, 5, 6, 7, 8, 250000000, time.UTC)
+	data := []byte(BinaryHeader + "d")
+	seconds := float64(expected.Unix()) + 0.25
+	data = binary.BigEndian.AppendUint64(data, math.Float64bits(seconds))
+
+	var dst time.Time
+	if err := UnmarshalBinary(data, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if !dst.Equal(expected) {
+		t.Fatalf("Expected %v but got %v", expected, dst)
+	}
+}
+
+func TestBinaryUnmarshalURI(t *testing.T) {
+	const uri = "http://example.com/a?b=c"
+	data := []byte(BinaryHeader + "{")
+	data = binary.BigEndian.AppendUint32(data, 2)
+	for _, key := range []string{"url", "link"} {
+		data = append(data, 'k')
+		data = binary.BigEndian.AppendUint32(data, uint32(len(key)))
+		data = append(data, key...)
+		data = append(data, 'l')
+		data = binary.BigEndian.AppendUint32(data, uint32(len(uri)))
+		data = append(data, uri...)
+	}
+	data = append(data, '}')
+
+	var dst struct {
+		URL  url.URL `llsd:"url"`
+		Link URL     `llsd:"link"`
+	}
+	if err := UnmarshalBinary(data, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.URL.String() != uri || dst.Link != uri {
+		t.Fatalf("Expected %s but got %s, %s", uri, dst.URL.String(), dst.Link)
+	}
+}
+
+func TestBinaryScanBadOpcode(t *testing.T) {
+	scanner := NewBinaryScanner(bytes.NewReader([]byte("[\x00\x00\x00\x02i\x00\x00\x00\x01x]")))
+	var err error
+	for err == nil {
+		_, err = scanner.Token()
+	}
+	invalid, ok := err.(*InvalidLLSDError)
+	if !ok {
+		t.Fatalf("Expected InvalidLLSDError, got %v", err)
+	}
+	if invalid.Offset != 11 {
+		t.Fatalf("Expected InvalidLLSDError to report offset %d but got %d", 11, invalid.Offset)
+	}
+}
+
+func TestBinaryDecodeGzipStream(t *testing.T) {
+	binaryInit()
+	var expected any
+	if err := UnmarshalBinary(binaryBytes, &expected); err != nil {
+		t.Fatal(err)
+	}
+
+	// Decode straight from the compressed file, with short reads
+	f, err := os.Open("testdata/basic.bin.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got any
+	if err := NewBinaryDecoder(iotest.HalfReader(gz)).Unmarshal(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v but got %v", expected, got)
+	}
+
+	// Offsets are of the uncompressed stream
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	_, _ = zw.Write([]byte("[\x00\x00\x00\x02i\x00\x00\x00\x01x]"))
+	_ = zw.Close()
+	gz, err = gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewBinaryDecoder(iotest.OneByteReader(gz)).Unmarshal(&got)
+	var invalid *InvalidLLSDError
+	if !errors.As(err, &invalid) || invalid.Offset != 11 {
+		t.Fatalf("Expected InvalidLLSDError at offset 11 but got %v", err)
+	}
+}
+
+func TestBinaryScanBytes(t *testing.T) {
+	binaryInit()
+	scanner := NewBinaryScannerBytes(binaryBytes)
+	for {
+		tok, err := scanner.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, ok := tok.(Scalar); ok && s.Type == String {
+			// Scalar data should alias the input
+			if &s.Data[0] != &binaryBytes[scanner.Offset()-int64(len(s.Data))] {
+				t.Fatalf("Expected scalar data to alias input")
+			}
+		}
+	}
+}
+
+func TestBinaryScanBytesAllocs(t *testing.T) {
+	binaryInit()
+	var scalar Scalar
+	var keys, scalars int
+	allocs := testing.AllocsPerRun(10, func() {
+		keys, scalars = 0, 0
+		scanner := NewBinaryScannerBytes(binaryBytes)
+		for {
+			tok, err := scanner.Next(&scalar)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch tok.(type) {
+			case Key:
+				keys++
+			case Scalar:
+				scalars++
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("Expected scanning to allocate nothing but got %v allocs", allocs)
+	}
+	if keys == 0 || scalars == 0 {
+		t.Fatalf("Expected keys and scalars but got %d keys and %d scalars", keys, scalars)
+	}
+}
+
+func TestBinaryScanEmptyTrailingElement(t *testing.T) {
+	for _, data := range []string{"s\x00\x00\x00\x00", "k\x00\x00\x00\x00", "b\x00\x00\x00\x00"} {
+		for _, scanner := range []*BinaryScanner{
+			NewBinaryScanner(strings.NewReader(data)),
+			NewBinaryScannerBytes([]byte(data)),
+		} {
+			tok, err := scanner.Token()
+			if err != nil {
+				t.Fatalf("%q: %v", data, err)
+			}
+			if s, ok := tok.(Scalar); ok && len(s.Data) != 0 || !ok && tok != Key("") {
+				t.Fatalf("%q: expected empty element but got %v", data, tok)
+			}
+			if _, err := scanner.Token(); err != io.EOF {
+				t.Fatalf("%q: expected EOF but got %v", data, err)
+			}
+		}
+	}
+}
+
+func TestBinaryScanTruncatedAtEnd(t *testing.T) {
+	for _, data := range []string{"s\x00\x00\x00\x10", "s\x00\x00", "s", "i"} {
+		for _, scanner := range []*BinaryScanner{
+			NewBinaryScanner(strings.NewReader(data)),
+			NewBinaryScanner(iotest.OneByteReader(strings.NewReader(data))),
+			NewBinaryScannerBytes([]byte(data)),
+		} {
+			_, err := scanner.Token()
+			var invalid *InvalidLLSDError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("%q: expected InvalidLLSDError but got %v", data, err)
+			}
+		}
+	}
+}
+
+func TestBinaryScanSizeBoundary(t *testing.T) {
+	data := []byte("s\xff\xff\xff\xffabc")
+	for _, scanner := range []*BinaryScanner{
+		NewBinaryScanner(bytes.NewReader(data)),
+		NewBinaryScannerBytes(data),
+	} {
+		_, err := scanner.Token()
+		invalid, ok := err.(*InvalidLLSDError)
+		if !ok {
+			t.Fatalf("Expected InvalidLLSDError, got %v", err)
+		}
+		expected := "Invalid LLSD: element of 4294967295 bytes exceeds remaining input"
+		if invalid.Error() != expected {
+			t.Fatalf("Expected error \"%s\" but got \"%s\"", expected, invalid)
+		}
+		if invalid.Offset != 5 {
+			t.Fatalf("Expected InvalidLLSDError to report offset %d but got %d", 5, invalid.Offset)
+		}
+	}
+}
+
+func TestBinaryMaxEntries(t *testing.T) {
+	// Array declaring 2^32-1 elements
+	data := []byte("[\xff\xff\xff\xffi\x00\x00\x00\x01i\x00\x00\x00\x02i\x00\x00\x00\x03]")
+	var dst []int
+	dec := NewBinaryDecoderWith(bytes.NewReader(data), DecoderOptions{MaxEntries: 2})
+	err := dec.Unmarshal(&dst)
+	if !errorContains(err, "Invalid LLSD: array exceeds 2 entries") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cap(dst) > 4 {
+		t.Fatalf("Expected declared array size not to be allocated, got capacity %d", cap(dst))
+	}
+
+	dec = NewBinaryDecoderWith(bytes.NewReader(data), DecoderOptions{MaxTotalTokens: 3})
+	err = dec.Unmarshal(&dst)
+	if !errorContains(err, "Invalid LLSD: document exceeds 3 tokens") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDumpBinary(t *testing.T) {
+	binaryInit()
+	var b bytes.Buffer
+	if err := DumpBinary(binaryBytes, &b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, expected := range []string{
+		"00000010  { map\n",
+		"0000003e    s string (10 bytes) \"one minute\"\n",
+		"0000007d      r real 0.9878624\n",
+		"000000bc    b binary (11 bytes)\n",
+		"|Binary data|\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("Expected dump to contain %q, got:\n%s", expected, out)
+		}
+	}
+}
+
+func TestDumpBinaryDate(t *testing.T) {
+	data := make([]byte, 9)
+	data[0] = 'd'
+	binary.BigEndian.PutUint64(data[1:], math.Float64bits(1136214245.5))
+	var b bytes.Buffer
+	if err := DumpBinary(data, &b); err != nil {
+		t.Fatal(err)
+	}
+	expected := "00000000  d date 2006-01-02T15:04:05.5Z\n"
+	if b.String() != expected {
+		t.Fatalf("Expected %q but got %q", expected, b.String())
+	}
+}
+
+func TestDumpBinaryURI(t *testing.T) {
+	var b bytes.Buffer
+	if err := DumpBinary([]byte("l\x00\x00\x00\x12http://example.com"), &b); err != nil {
+		t.Fatal(err)
+	}
+	expected := "00000000  l uri (18 bytes) \"http://example.com\"\n"
+	if b.String() != expected {
+		t.Fatalf("Expected %q but got %q", expected, b.String())
+	}
+}
+
+func TestBinaryScanSizeRemaining(t *testing.T) {
+	// Readers of known length fail before reading the element
+	r := bytes.NewReader([]byte("s\x00\x00\x00\x10abc"))
+	_, err := NewBinaryScanner(r).Token()
+	if !errorContains(err, "Invalid LLSD: element of 16 bytes exceeds remaining input") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Len() != 3 {
+		t.Fatalf("Expected element not to be read, %d bytes remain", r.Len())
+	}
+
+	// Seekable readers are measured for large elements
+	data := []byte("s\x00\x20\x00\x00abc")
+	sr := io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))
+	_, err = NewBinaryScanner(sr).Token()
+	if !errorContains(err, "Invalid LLSD: element of 2097152 bytes exceeds remaining input") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pos, _ := sr.Seek(0, io.SeekCurrent); pos != 5 {
+		t.Fatalf("Expected element not to be read, reader at offset %d", pos)
+	}
+}
@@ -0,0 +1,71 @@
+package llsd
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Codec transforms the raw data of scalar values of fields tagged with its
+// registered name. Decode is applied before unmarshaling fields tagged
+// `llsd:"token,decode=name"` and Encode before writing string and binary
+// fields tagged `llsd:"token,encode=name"`. Binary values are transformed
+// as bytes, after decoding and before encoding their text representation.
+// This is useful for encrypted or specially encoded payloads.
+type Codec struct {
+	Decode func([]byte) ([]byte, error)
+	Encode func([]byte) ([]byte, error)
+}
+
+var codecs sync.Map // map[string]Codec
+
+// RegisterCodec registers a codec under the given name, replacing any codec
+// previously registered with that name.
+func RegisterCodec(name string, c Codec) {
+	codecs.Store(name, c)
+}
+
+// decodeCodec applies the named codec to the current scalar token. Binary
+// tokens are left for binary, which applies the codec to the decoded bytes so
+// that it mirrors encodeCodec.
+func (u *Unmarshaler) decodeCodec(name string) error {
+	tok, ok := u.tok.(Scalar)
+	if !ok || tok.Type == Binary {
+		return nil
+	}
+	data, err := decodeWith(name, tok.Data)
+	if err != nil {
+		return err
+	}
+	tok.Data = data
+	u.tok = tok
+	return nil
+}
+
+// decodeWith applies the Decode function of the named codec to data.
+func decodeWith(name string, data []byte) ([]byte, error) {
+	c, ok := codecs.Load(name)
+	if !ok || c.(Codec).Decode == nil {
+		return nil, fmt.Errorf("LLSD: Unknown codec %q", name)
+	}
+	return c.(Codec).Decode(data)
+}
+
+// encodeCodec applies the named codec to a string or byte slice value,
+// returning the transformed value.
+func encodeCodec(name string, v reflect.Value) (reflect.Value, error) {
+	c, ok := codecs.Load(name)
+	if !ok || c.(Codec).Encode == nil {
+		return v, fmt.Errorf("LLSD: Unknown codec %q", name)
+	}
+	switch {
+	case v.Kind() == reflect.String:
+		data, err := c.(Codec).Encode([]byte(v.String()))
+		return reflect.ValueOf(string(data)), err
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		data, err := c.(Codec).Encode(v.Bytes())
+		return reflect.ValueOf(data), err
+	default:
+		return v, &MarshalTypeError{Type: v.Type()}
+	}
+}
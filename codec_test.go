@@ -0,0 +1,110 @@
+package llsd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func rot13(b []byte) ([]byte, error) {
+	dst := make([]byte, len(b))
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z':
+			c = 'a' + (c-'a'+13)%26
+		case c >= 'A' && c <= 'Z':
+			c = 'A' + (c-'A'+13)%26
+		}
+		dst[i] = c
+	}
+	return dst, nil
+}
+
+func TestCodecDecode(t *testing.T) {
+	RegisterCodec("rot13", Codec{Decode: rot13})
+	var dst struct {
+		Token string `llsd:"token,decode=rot13"`
+		Plain string `llsd:"plain"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <map>
+	  	<key>token</key><string>Uryyb</string>
+	  	<key>plain</key><string>Uryyb</string>
+	  </map>
+	</llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Token != "Hello" {
+		t.Fatalf("Expected dst.Token to equal \"Hello\" but got \"%s\"", dst.Token)
+	}
+	if dst.Plain != "Uryyb" {
+		t.Fatalf("Expected dst.Plain to equal \"Uryyb\" but got \"%s\"", dst.Plain)
+	}
+}
+
+func TestCodecUnknown(t *testing.T) {
+	var dst struct {
+		Token string `llsd:"token,decode=unknown"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>token</key><string>a</string></map></llsd>`
+	err := UnmarshalXML([]byte(xml), &dst)
+	if !errorContains(err, "LLSD: Unknown codec \"unknown\"") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	RegisterCodec("rot13", Codec{Decode: rot13, Encode: rot13})
+	type T struct {
+		Token string `llsd:"token,encode=rot13,decode=rot13"`
+	}
+	src := T{Token: "Hello"}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<key>token</key><string>Uryyb</string>"
+	if !strings.Contains(string(b), expected) {
+		t.Fatalf("Expected %s, got %s", expected, string(b))
+	}
+	var dst T
+	if err := UnmarshalXML(b, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst != src {
+		t.Fatalf("Expected %v, got %v", src, dst)
+	}
+}
+
+func xor(b []byte) ([]byte, error) {
+	dst := make([]byte, len(b))
+	for i, c := range b {
+		dst[i] = c ^ 0x55
+	}
+	return dst, nil
+}
+
+func TestCodecRoundTripBinary(t *testing.T) {
+	RegisterCodec("xor", Codec{Decode: xor, Encode: xor})
+	type T struct {
+		Data []byte `llsd:"data,encode=xor,decode=xor"`
+	}
+	src := T{Data: []byte("Hello")}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<key>data</key><binary>1D3039393A</binary>"
+	if !strings.Contains(string(b), expected) {
+		t.Fatalf("Expected %s, got %s", expected, string(b))
+	}
+	var dst T
+	if err := UnmarshalXML(b, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst.Data, src.Data) {
+		t.Fatalf("Expected %q, got %q", src.Data, dst.Data)
+	}
+}
@@ -1,6 +1,7 @@
 package llsd
 
 import (
+	"bytes"
 	"encoding/ascii85"
 	"encoding/base64"
 	"encoding/binary"
@@ -15,9 +16,10 @@ import (
 type ScalarType int
 
 const (
-	Base16 = "base16"
-	Base64 = "base64"
-	Base85 = "base85"
+	Base16    = "base16"
+	Base64    = "base64"
+	Base64URL = "base64url"
+	Base85    = "base85"
 )
 
 const (
@@ -57,6 +59,29 @@ func (t ScalarType) String() string {
 	}
 }
 
+// scalarTypes maps names of scalar types, as returned by String, to types.
+var scalarTypes = map[string]ScalarType{
+	"undef":   Undefined,
+	"boolean": Boolean,
+	"integer": Integer,
+	"real":    Real,
+	"uuid":    UUIDType,
+	"string":  String,
+	"binary":  Binary,
+	"date":    Date,
+	"uri":     URI,
+}
+
+// ParseScalarType returns the scalar type with the given name, such as "real",
+// which is also its XML element name.
+func ParseScalarType(name string) (ScalarType, error) {
+	t, ok := scalarTypes[name]
+	if !ok {
+		return 0, fmt.Errorf("Unknown LLSD type \"%s\"", name)
+	}
+	return t, nil
+}
+
 type ArrayStart struct{}
 type ArrayEnd struct{}
 type MapStart struct{}
@@ -72,27 +97,111 @@ type UUID [16]byte
 type Key string
 type URL string
 
+func (ArrayStart) String() string { return "[" }
+func (ArrayEnd) String() string   { return "]" }
+func (MapStart) String() string   { return "{" }
+func (MapEnd) String() string     { return "}" }
+func (k Key) String() string      { return string(k) }
+
+func (s Scalar) String() string {
+	return fmt.Sprintf("%s(%q)", s.Type, s.Data)
+}
+
+// Equal reports whether t is also an ArrayStart.
+func (ArrayStart) Equal(t Token) bool {
+	_, ok := t.(ArrayStart)
+	return ok
+}
+
+// Equal reports whether t is also an ArrayEnd.
+func (ArrayEnd) Equal(t Token) bool {
+	_, ok := t.(ArrayEnd)
+	return ok
+}
+
+// Equal reports whether t is also a MapStart.
+func (MapStart) Equal(t Token) bool {
+	_, ok := t.(MapStart)
+	return ok
+}
+
+// Equal reports whether t is also a MapEnd.
+func (MapEnd) Equal(t Token) bool {
+	_, ok := t.(MapEnd)
+	return ok
+}
+
+// Equal reports whether t is the same key.
+func (k Key) Equal(t Token) bool {
+	other, ok := t.(Key)
+	return ok && k == other
+}
+
+// Equal reports whether t is a scalar of the same type, data and attributes.
+// Nil and empty data or attributes are equal.
+func (s Scalar) Equal(t Token) bool {
+	other, ok := t.(Scalar)
+	if !ok || s.Type != other.Type || !bytes.Equal(s.Data, other.Data) || len(s.Attr) != len(other.Attr) {
+		return false
+	}
+	for k, v := range s.Attr {
+		if w, ok := other.Attr[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
 func (u UUID) String() string {
 	return hex.EncodeToString(u[:])
 }
 
+// IsZero reports whether u is the zero UUID, with all bytes zero.
+func (u UUID) IsZero() bool {
+	return u == UUID{}
+}
+
+// Equal reports whether u and o are the same UUID.
+func (u UUID) Equal(o UUID) bool {
+	return u == o
+}
+
 type TokenReader interface {
 	Token() (Token, error) // Get next LLSD token
 	Offset() int64         // Input stream offset
 }
 
-type scalarDecoder interface {
-	real([]byte) (float64, error)
-	uuid([]byte) (UUID, error)
-	integer([]byte) (int64, error)
-	binary([]byte, string) ([]byte, error)
-	date([]byte) (time.Time, error)
-	boolean([]byte) (bool, error)
+type TokenWriter interface {
+	WriteToken(Token) error // Write next LLSD token
+}
+
+// ScalarDecoder parses the data of scalar tokens into Go values. Binary is
+// given the value of the encoding attribute, if any. Decoders are chosen by
+// format and may be replaced with Unmarshaler.SetScalarDecoder, such as to
+// accept locale-specific reals.
+type ScalarDecoder interface {
+	Real([]byte) (float64, error)
+	UUID([]byte) (UUID, error)
+	Integer([]byte) (int64, error)
+	Binary([]byte, string) ([]byte, error)
+	Date([]byte) (time.Time, error)
+	Boolean([]byte) (bool, error)
+}
+
+// NewTextScalarDecoder returns the ScalarDecoder of text formats such as XML,
+// for custom decoders to delegate to.
+func NewTextScalarDecoder() ScalarDecoder {
+	return &textDecoder{}
+}
+
+// NewBinaryScalarDecoder returns the ScalarDecoder of binary LLSD.
+func NewBinaryScalarDecoder() ScalarDecoder {
+	return &binaryDecoder{}
 }
 
 type textDecoder struct{}
 
-func (d *textDecoder) real(c []byte) (float64, error) {
+func (d *textDecoder) Real(c []byte) (float64, error) {
 	// Default value = 0.0
 	if len(c) == 0 || c == nil {
 		return 0.0, nil
@@ -104,7 +213,7 @@ func (d *textDecoder) real(c []byte) (float64, error) {
 	return f, nil
 }
 
-func (d *textDecoder) uuid(c []byte) (UUID, error) {
+func (d *textDecoder) UUID(c []byte) (UUID, error) {
 	// Default value = 00000000-00000000-00000000-00000000
 	if len(c) == 0 || c == nil {
 		return [16]byte{}, nil
@@ -118,24 +227,26 @@ func (d *textDecoder) uuid(c []byte) (UUID, error) {
 	return u, nil
 }
 
-func (d *textDecoder) integer(c []byte) (int64, error) {
+func (d *textDecoder) Integer(c []byte) (int64, error) {
 	i, err := strconv.Atoi(string(c))
 	return int64(i), err
 }
 
-func (d *textDecoder) binary(c []byte, encoding string) ([]byte, error) {
+func (d *textDecoder) Binary(c []byte, encoding string) ([]byte, error) {
 	if len(c) == 0 || c == nil {
 		return c, nil
 	}
+	// Encoded text is often wrapped over several lines
+	c = stripSpace(c)
 	switch encoding {
 	case Base16, "":
 		dst := make([]byte, hex.DecodedLen(len(c)))
 		_, err := hex.Decode(dst, c)
 		return dst, err
 	case Base64:
-		dst := make([]byte, base64.StdEncoding.DecodedLen(len(c)))
-		_, err := base64.StdEncoding.Decode(dst, c)
-		return dst, err
+		return decodeBase64(c, base64.StdEncoding, base64.RawStdEncoding)
+	case Base64URL:
+		return decodeBase64(c, base64.URLEncoding, base64.RawURLEncoding)
 	case Base85:
 		dst := make([]byte, ascii85.MaxEncodedLen(len(c)))
 		_, _, err := ascii85.Decode(dst, c, true)
@@ -145,7 +256,40 @@ func (d *textDecoder) binary(c []byte, encoding string) ([]byte, error) {
 	}
 }
 
-func (d *textDecoder) boolean(c []byte) (bool, error) {
+// stripSpace returns c without ASCII whitespace, copying only when c
+// contains any.
+func stripSpace(c []byte) []byte {
+	i := bytes.IndexAny(c, " \t\r\n")
+	if i < 0 {
+		return c
+	}
+	dst := append(make([]byte, 0, len(c)), c[:i]...)
+	for _, b := range c[i:] {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+		default:
+			dst = append(dst, b)
+		}
+	}
+	return dst
+}
+
+// decodeBase64 decodes padded base64, falling back to the unpadded raw
+// encoding for producers that omit padding.
+func decodeBase64(c []byte, enc, raw *base64.Encoding) ([]byte, error) {
+	dst := make([]byte, raw.DecodedLen(len(c)))
+	n, err := enc.Decode(dst, c)
+	if err == nil {
+		return dst[:n], nil
+	}
+	n, rawErr := raw.Decode(dst, c)
+	if rawErr != nil {
+		return dst, err
+	}
+	return dst[:n], nil
+}
+
+func (d *textDecoder) Boolean(c []byte) (bool, error) {
 	if len(c) == 0 || c == nil {
 		return false, nil
 	}
@@ -157,7 +301,7 @@ func (d *textDecoder) boolean(c []byte) (bool, error) {
 	return false, fmt.Errorf("Invalid boolean value %s", c)
 }
 
-func (d *textDecoder) date(c []byte) (time.Time, error) {
+func (d *textDecoder) Date(c []byte) (time.Time, error) {
 	if len(c) == 0 || c == nil {
 		return time.Unix(0, 0), nil
 	}
@@ -166,7 +310,7 @@ func (d *textDecoder) date(c []byte) (time.Time, error) {
 
 type binaryDecoder struct{}
 
-func (d *binaryDecoder) real(b []byte) (float64, error) {
+func (d *binaryDecoder) Real(b []byte) (float64, error) {
 	// Default value = 0.0
 	if len(b) == 0 || b == nil {
 		return 0.0, nil
@@ -175,7 +319,7 @@ func (d *binaryDecoder) real(b []byte) (float64, error) {
 	return math.Float64frombits(bits), nil
 }
 
-func (d *binaryDecoder) uuid(b []byte) (UUID, error) {
+func (d *binaryDecoder) UUID(b []byte) (UUID, error) {
 	// Default value = 00000000-00000000-00000000-00000000
 	if len(b) == 0 || b == nil {
 		return [16]byte{}, nil
@@ -185,22 +329,24 @@ func (d *binaryDecoder) uuid(b []byte) (UUID, error) {
 	return u, nil
 }
 
-func (d *binaryDecoder) integer(b []byte) (int64, error) {
+func (d *binaryDecoder) Integer(b []byte) (int64, error) {
 	return int64(binary.BigEndian.Uint32(b)), nil
 }
 
-func (d *binaryDecoder) binary(b []byte, encoding string) ([]byte, error) {
+func (d *binaryDecoder) Binary(b []byte, encoding string) ([]byte, error) {
 	return b, nil
 }
 
-func (d *binaryDecoder) boolean(b []byte) (bool, error) {
+func (d *binaryDecoder) Boolean(b []byte) (bool, error) {
 	return len(b) > 1, nil
 }
 
-func (d *binaryDecoder) date(b []byte) (time.Time, error) {
-	epoch, err := d.integer(b)
+// Date reads a big-endian float64 of seconds since epoch.
+func (d *binaryDecoder) Date(b []byte) (time.Time, error) {
+	epoch, err := d.Real(b)
 	if err != nil {
 		return time.Unix(0, 0), err
 	}
-	return time.Unix(epoch, 0), nil
+	sec, frac := math.Modf(epoch)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9))).UTC(), nil
 }
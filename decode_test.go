@@ -2,6 +2,7 @@ package llsd
 
 import (
 	"bytes"
+	"fmt"
 	"testing"
 )
 
@@ -17,7 +18,7 @@ func TestTextReal(t *testing.T) {
 		{val: []byte("-1.0"), expected: -1.0},
 		{val: []byte("0.0"), expected: 0.0},
 	} {
-		got, err := d.real(c.val)
+		got, err := d.Real(c.val)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -38,7 +39,7 @@ func TestTextUUID(t *testing.T) {
 		{val: []byte("6d1e8348-df64-486b-bf4e-afe049dc3b83"), expected: "6d1e8348df64486bbf4eafe049dc3b83"},
 		{val: []byte("6d1e8348df64486bbf4eafe049dc3b83"), expected: "6d1e8348df64486bbf4eafe049dc3b83"},
 	} {
-		got, err := d.uuid(c.val)
+		got, err := d.UUID(c.val)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -60,10 +61,16 @@ func TestBinary(t *testing.T) {
 		{val: []byte("42696E6172792064617461"), expected: "Binary data", encoding: ""},
 		{val: []byte("42696E6172792064617461"), expected: "Binary data", encoding: "base16"},
 		{val: []byte("QmluYXJ5IGRhdGE="), expected: "Binary data", encoding: "base64"},
+		{val: []byte("QmluYXJ5IGRhdGE"), expected: "Binary data", encoding: "base64"},
+		{val: []byte("-_-_"), expected: "\xfb\xff\xbf", encoding: "base64url"},
+		{val: []byte("QmluYXJ5IGRhdGE"), expected: "Binary data", encoding: "base64url"},
 		{val: []byte("6>:=GEd8d<@<>o"), expected: "Binary data", encoding: "base85"},
+		{val: []byte("42696E61 72792064\n617461"), expected: "Binary data", encoding: "base16"},
+		{val: []byte("QmluYXJ5\n\tIGRhdGE=\r\n"), expected: "Binary data", encoding: "base64"},
+		{val: []byte("6>:=G Ed8d<\n@<>o"), expected: "Binary data", encoding: "base85"},
 		{val: []byte("f"), encoding: "a", err: "Unknown encoding \"a\""},
 	} {
-		got, err := d.binary(c.val, c.encoding)
+		got, err := d.Binary(c.val, c.encoding)
 		if !errorContains(err, c.err) {
 			t.Fatal(err)
 		}
@@ -87,7 +94,7 @@ func TestBoolean(t *testing.T) {
 		{val: []byte("false"), expected: false},
 		{val: []byte("a"), err: "Invalid boolean value a"},
 	} {
-		got, err := d.boolean(c.val)
+		got, err := d.Boolean(c.val)
 		if !errorContains(err, c.err) {
 			t.Fatal(err)
 		}
@@ -96,3 +103,61 @@ func TestBoolean(t *testing.T) {
 		}
 	}
 }
+
+func TestUUIDIsZero(t *testing.T) {
+	var zero UUID
+	if !zero.IsZero() {
+		t.Fatalf("Expected zero UUID to be zero")
+	}
+	id := UUID{0x6d, 0x1e}
+	if id.IsZero() {
+		t.Fatalf("Expected %s not to be zero", id)
+	}
+	if !id.Equal(UUID{0x6d, 0x1e}) {
+		t.Fatalf("Expected %s to equal itself", id)
+	}
+	if id.Equal(zero) {
+		t.Fatalf("Expected %s not to equal %s", id, zero)
+	}
+}
+
+func TestParseScalarType(t *testing.T) {
+	for ty := Undefined; ty <= URI; ty++ {
+		parsed, err := ParseScalarType(ty.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != ty {
+			t.Fatalf("Expected %s to parse as %d but got %d", ty, ty, parsed)
+		}
+	}
+	if _, err := ParseScalarType("map"); err == nil {
+		t.Fatal("Expected error parsing unknown type \"map\"")
+	}
+}
+
+func TestTokenEqual(t *testing.T) {
+	for _, c := range []struct {
+		a, b     Token
+		expected bool
+		str      string
+	}{
+		{MapStart{}, MapStart{}, true, "{"},
+		{MapEnd{}, MapStart{}, false, "}"},
+		{ArrayStart{}, ArrayStart{}, true, "["},
+		{ArrayEnd{}, ArrayEnd{}, true, "]"},
+		{Key("a"), Key("a"), true, "a"},
+		{Key("a"), Key("b"), false, "a"},
+		{Scalar{Type: String, Data: []byte("hi")}, Scalar{Type: String, Data: []byte("hi")}, true, `string("hi")`},
+		{Scalar{Type: String, Data: []byte("hi")}, Scalar{Type: Binary, Data: []byte("hi")}, false, `string("hi")`},
+		{Scalar{Type: Undefined}, Scalar{Type: Undefined, Data: []byte{}, Attr: map[string]string{}}, true, `undef("")`},
+		{Scalar{Type: Binary, Attr: map[string]string{"encoding": "base64"}}, Scalar{Type: Binary}, false, `binary("")`},
+	} {
+		if got := c.a.(interface{ Equal(Token) bool }).Equal(c.b); got != c.expected {
+			t.Fatalf("Expected %v.Equal(%v) to be %v", c.a, c.b, c.expected)
+		}
+		if got := c.a.(fmt.Stringer).String(); got != c.str {
+			t.Fatalf("Expected %q but got %q", c.str, got)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package llsd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// DumpBinary writes a human readable listing of binary LLSD to w for
+// troubleshooting. Each token is written on its own line, indented by depth,
+// with its offset, opcode and decoded value. Binary values are followed by a
+// hex dump of their contents.
+func DumpBinary(data []byte, w io.Writer) error {
+	s := NewBinaryScannerBytes(data)
+	depth := 0
+	for {
+		start := s.Offset()
+		if start == 0 && bytes.HasPrefix(data, []byte(BinaryHeader)) {
+			start = int64(len(BinaryHeader))
+		}
+		tok, err := s.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch tok.(type) {
+		case MapEnd, ArrayEnd:
+			depth--
+		}
+		indent := strings.Repeat("  ", depth)
+		if _, err = fmt.Fprintf(w, "%08x  %s%s\n", start, indent, dumpToken(tok)); err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case MapStart, ArrayStart:
+			depth++
+		case Scalar:
+			if tok.Type == Binary && len(tok.Data) > 0 {
+				for _, line := range strings.Split(strings.TrimSuffix(hex.Dump(tok.Data), "\n"), "\n") {
+					if _, err = fmt.Fprintf(w, "%8s  %s  %s\n", "", indent, line); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+}
+
+// dumpToken describes a token by its opcode and value.
+func dumpToken(tok Token) string {
+	switch tok := tok.(type) {
+	case MapStart:
+		return "{ map"
+	case MapEnd:
+		return "}"
+	case ArrayStart:
+		return "[ array"
+	case ArrayEnd:
+		return "]"
+	case Key:
+		return fmt.Sprintf("k key (%d bytes) %q", len(tok), string(tok))
+	case Scalar:
+		switch tok.Type {
+		case Undefined:
+			return "! undef"
+		case Boolean:
+			if len(tok.Data) > 0 {
+				return "1 boolean true"
+			}
+			return "0 boolean false"
+		case Integer:
+			return fmt.Sprintf("i integer %d", int32(binary.BigEndian.Uint32(tok.Data)))
+		case Real:
+			return fmt.Sprintf("r real %g", math.Float64frombits(binary.BigEndian.Uint64(tok.Data)))
+		case UUIDType:
+			var id UUID
+			copy(id[:], tok.Data)
+			return "u uuid " + id.String()
+		case String:
+			return fmt.Sprintf("s string (%d bytes) %q", len(tok.Data), tok.Data)
+		case Binary:
+			return fmt.Sprintf("b binary (%d bytes)", len(tok.Data))
+		case URI:
+			return fmt.Sprintf("l uri (%d bytes) %q", len(tok.Data), tok.Data)
+		case Date:
+			date, err := NewBinaryScalarDecoder().Date(tok.Data)
+			if err != nil {
+				break
+			}
+			return "d date " + date.Format(time.RFC3339Nano)
+		}
+	}
+	return fmt.Sprintf("? %v", tok)
+}
@@ -0,0 +1,51 @@
+package llsd
+
+import "errors"
+
+// ErrorCoder is implemented by errors exposing a numeric code, which
+// MarshalError includes in the fault map.
+type ErrorCoder interface {
+	error
+	ErrorCode() int
+}
+
+// Fault is an error decoded from an LLSD fault map of the form
+// {"error": {"message": ..., "code": ...}}.
+type Fault struct {
+	Message string `llsd:"message"`
+	Code    int    `llsd:"code,omitempty"`
+}
+
+func (f *Fault) Error() string {
+	return f.Message
+}
+
+func (f *Fault) ErrorCode() int {
+	return f.Code
+}
+
+// faultMap is the document written by MarshalError.
+type faultMap struct {
+	Error *Fault `llsd:"error"`
+}
+
+// MarshalError writes err as an LLSD XML fault map. The code of the first
+// error in err's chain implementing ErrorCoder is included, if any.
+func MarshalError(err error) ([]byte, error) {
+	fault := &Fault{Message: err.Error()}
+	var coder ErrorCoder
+	if errors.As(err, &coder) {
+		fault.Code = coder.ErrorCode()
+	}
+	return MarshalXML(&faultMap{Error: fault})
+}
+
+// UnmarshalFault reads an LLSD XML fault map written by MarshalError,
+// returning a nil Fault when the document has no "error" key.
+func UnmarshalFault(data []byte) (*Fault, error) {
+	var m faultMap
+	if err := UnmarshalXML(data, &m); err != nil {
+		return nil, err
+	}
+	return m.Error, nil
+}
@@ -0,0 +1,56 @@
+package llsd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type codedError struct {
+	code int
+}
+
+func (e codedError) Error() string {
+	return fmt.Sprintf("failed with code %d", e.code)
+}
+
+func (e codedError) ErrorCode() int {
+	return e.code
+}
+
+func TestMarshalError(t *testing.T) {
+	for _, c := range []struct {
+		err      error
+		expected string
+		code     int
+	}{
+		{errors.New("not found"), "<map><key>error</key><map><key>message</key><string>not found</string></map></map>", 0},
+		{fmt.Errorf("request: %w", codedError{404}), "<key>code</key><integer>404</integer>", 404},
+	} {
+		b, err := MarshalError(c.err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), c.expected) {
+			t.Fatalf("Expected %s, got %s", c.expected, b)
+		}
+
+		fault, err := UnmarshalFault(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fault == nil || fault.Error() != c.err.Error() || fault.ErrorCode() != c.code {
+			t.Fatalf("Expected fault %q with code %d but got %v", c.err, c.code, fault)
+		}
+	}
+
+	// Documents without an error are not faults
+	fault, err := UnmarshalFault([]byte(`<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>result</key><integer>1</integer></map></llsd>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fault != nil {
+		t.Fatalf("Expected no fault but got %v", fault)
+	}
+}
@@ -0,0 +1,116 @@
+package llsd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Format is an LLSD serialization format.
+type Format int
+
+const (
+	FormatXML Format = iota
+	FormatBinary
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatXML:
+		return "xml"
+	case FormatBinary:
+		return "binary"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// Unmarshal decodes LLSD data of the given format into a new value of type T.
+func Unmarshal[T any](data []byte, format Format) (T, error) {
+	var v T
+	var err error
+	switch format {
+	case FormatXML:
+		err = UnmarshalXML(data, &v)
+	case FormatBinary:
+		err = UnmarshalBinary(data, &v)
+	default:
+		err = fmt.Errorf("LLSD: Unsupported format %s", format)
+	}
+	return v, err
+}
+
+// Marshal encodes a value of type T as LLSD of the given format.
+func Marshal[T any](v T, format Format) ([]byte, error) {
+	switch format {
+	case FormatXML:
+		return MarshalXML(&v)
+	default:
+		return nil, fmt.Errorf("LLSD: Unsupported format %s", format)
+	}
+}
+
+// DecodeFile decodes the LLSD file at path of the given format into v. Files
+// compressed with gzip, such as .xml.gz, are detected and decompressed.
+func DecodeFile(path string, v any, format Format) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	switch format {
+	case FormatXML:
+		return NewXMLDecoder(r).Unmarshal(v)
+	case FormatBinary:
+		return NewBinaryDecoder(r).Unmarshal(v)
+	default:
+		return fmt.Errorf("LLSD: Unsupported format %s", format)
+	}
+}
+
+// EncodeFile encodes v as LLSD of the given format into the file at path,
+// compressing it with gzip if requested.
+func EncodeFile(path string, v any, format Format, compress bool) error {
+	if format != FormatXML {
+		return fmt.Errorf("LLSD: Unsupported format %s", format)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	if err = NewXMLEncoder(w).Encode(v); err != nil {
+		return err
+	}
+	if gz != nil {
+		if err = gz.Close(); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// gzipMagic is the header of gzip compressed data.
+var gzipMagic = []byte{0x1f, 0x8b}
@@ -0,0 +1,153 @@
+package llsd
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenericXML(t *testing.T) {
+	type T struct {
+		A string
+	}
+	b, err := Marshal(T{A: "a"}, FormatXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := Unmarshal[T](b, FormatXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.A != "a" {
+		t.Fatalf("Expected dst.A to equal \"a\" but got \"%s\"", dst.A)
+	}
+}
+
+func TestGenericBinary(t *testing.T) {
+	binaryInit()
+	type T struct {
+		Scale string `llsd:"scale"`
+	}
+	dst, err := Unmarshal[T](binaryBytes, FormatBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Scale != "one minute" {
+		t.Fatalf("Expected dst.Scale to equal \"%s\", got \"%s\"", "one minute", dst.Scale)
+	}
+}
+
+func TestGenericUnsupportedFormat(t *testing.T) {
+	_, err := Marshal("a", Format(-1))
+	if !errorContains(err, "Unsupported format") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+type roundTripValue struct {
+	Undef   *string
+	Boolean bool
+	Integer int32
+	Real    float64
+	UUID    UUID
+	String  string
+	Binary  []byte
+	Date    time.Time
+	URI     URL
+	Pointer *int
+	Array   []map[string]int
+	Map     map[string][]string
+	Nested  *roundTripValue
+}
+
+// roundTrip marshals v to each format that supports output, unmarshals the
+// result and reports any difference from v.
+func roundTrip[T any](t *testing.T, v T) {
+	t.Helper()
+	for _, format := range []Format{FormatXML, FormatBinary} {
+		data, err := Marshal(v, format)
+		if err != nil {
+			if errorContains(err, "Unsupported format") {
+				// No encoder for this format yet
+				continue
+			}
+			t.Fatalf("%s: %v", format, err)
+		}
+		dst, err := Unmarshal[T](data, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !reflect.DeepEqual(dst, v) {
+			t.Fatalf("%s: Expected round trip to equal %+v but got %+v\n%s", format, v, dst, data)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	one := 1
+	id := UUID{0x67, 0x15, 0x3d, 0x5b, 0x36, 0x59, 0xaf, 0xb4, 0x85, 0x10, 0xad, 0xda, 0x2c, 0x03, 0x46, 0x49}
+	date := time.Date(2006, 2, 1, 14, 29, 53, 430000000, time.UTC)
+	roundTrip(t, true)
+	roundTrip(t, int32(-7))
+	roundTrip(t, 1.0/3)
+	roundTrip(t, 1e-7)
+	roundTrip(t, math.MaxFloat64)
+	roundTrip(t, float32(1e-7))
+	roundTrip(t, id)
+	roundTrip(t, "<string> & more")
+	roundTrip(t, []byte("Binary data"))
+	roundTrip(t, date)
+	roundTrip(t, URL("http://example.org/?a=1&b=2"))
+
+	roundTrip(t, roundTripValue{
+		Boolean: true,
+		Integer: 42,
+		Real:    -1.0 / 3,
+		UUID:    id,
+		String:  "a",
+		Binary:  []byte{0, 1, 2},
+		Date:    date,
+		URI:     "http://example.org",
+		Pointer: &one,
+		Array:   []map[string]int{{"a": 1}, {"b": 2}},
+		Map:     map[string][]string{"c": {"d", "e"}},
+		Nested:  &roundTripValue{String: "nested", Date: date, Array: []map[string]int{}, Map: map[string][]string{}, Binary: []byte{}},
+	})
+}
+
+func TestDecodeFile(t *testing.T) {
+	var element testElement
+	if err := DecodeFile("testdata/bench.xml.gz", &element, FormatXML); err != nil {
+		t.Fatal(err)
+	}
+	if len(element.Children) == 0 {
+		t.Fatal("Expected bench.xml.gz to decode children")
+	}
+
+	var stats struct {
+		Scale string `llsd:"scale"`
+	}
+	if err := DecodeFile("testdata/basic.bin.gz", &stats, FormatBinary); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Scale != "one minute" {
+		t.Fatalf("Expected scale \"one minute\" but got %q", stats.Scale)
+	}
+
+	// Files are written with and without compression
+	for _, compress := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "stats.xml")
+		if err := EncodeFile(path, &stats, FormatXML, compress); err != nil {
+			t.Fatal(err)
+		}
+		stats.Scale = ""
+		if err := DecodeFile(path, &stats, FormatXML); err != nil {
+			t.Fatal(err)
+		}
+		if stats.Scale != "one minute" {
+			t.Fatalf("Expected scale \"one minute\" but got %q (compress: %t)", stats.Scale, compress)
+		}
+	}
+}
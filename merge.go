@@ -0,0 +1,23 @@
+package llsd
+
+// Merge deep-merges src into dst, maps of values as decoded into any, and
+// returns dst. Keys of src override those of dst, except that where both
+// values are maps they are merged recursively. Arrays and scalars are
+// replaced rather than merged, and an undef (nil) value in src replaces the
+// value in dst rather than deleting it. A nil dst is allocated. Maps of src
+// are copied, never stored in dst.
+func Merge(dst, src map[string]any) map[string]any {
+	if dst == nil {
+		dst = make(map[string]any, len(src))
+	}
+	for key, value := range src {
+		if srcMap, ok := value.(map[string]any); ok {
+			// Copy maps of src so later merges into dst leave src unchanged
+			dstMap, _ := dst[key].(map[string]any)
+			dst[key] = Merge(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+	return dst
+}
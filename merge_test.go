@@ -0,0 +1,45 @@
+package llsd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	base := `<?xml version="1.0" encoding="UTF-8"?><llsd><map>
+<key>name</key><string>base</string>
+<key>limits</key><map><key>max</key><integer>10</integer><key>min</key><integer>1</integer></map>
+<key>hosts</key><array><string>a</string><string>b</string></array>
+</map></llsd>`
+	patch := `<?xml version="1.0" encoding="UTF-8"?><llsd><map>
+<key>limits</key><map><key>max</key><integer>20</integer></map>
+<key>hosts</key><array><string>c</string></array>
+</map></llsd>`
+	var dst, src map[string]any
+	if err := UnmarshalXML([]byte(base), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnmarshalXML([]byte(patch), &src); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"name":   "base",
+		"limits": map[string]any{"max": int32(20), "min": int32(1)},
+		"hosts":  []any{"c"},
+	}
+	if got := Merge(dst, src); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v but got %v", expected, got)
+	}
+
+	if got := Merge(nil, src); !reflect.DeepEqual(got, src) {
+		t.Fatalf("Expected %v but got %v", src, got)
+	}
+
+	// Maps taken from src are copies, so merging into dst leaves src alone
+	merged := Merge(nil, src)
+	Merge(merged, map[string]any{"limits": map[string]any{"max": int32(30)}})
+	if limits := src["limits"].(map[string]any); limits["max"] != int32(20) {
+		t.Fatalf("Expected src limits to be unchanged but got %v", limits)
+	}
+}
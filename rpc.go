@@ -0,0 +1,82 @@
+package llsd
+
+import "reflect"
+
+// RPCRequest is an LLSD-RPC request envelope, a map of the method called
+// and its parameter.
+type RPCRequest struct {
+	Method    string `llsd:"method"`
+	Parameter any    `llsd:"parameter"`
+}
+
+// RPCResponse is an LLSD-RPC response envelope, a map holding either the
+// result of a call or the fault it failed with.
+type RPCResponse struct {
+	Result any    `llsd:"result,omitempty"`
+	Error  *Fault `llsd:"error,omitempty"`
+}
+
+// rpcRequest and rpcResponse capture envelope values for decoding into the
+// caller's types.
+type rpcRequest struct {
+	Method    string     `llsd:"method"`
+	Parameter RawMessage `llsd:"parameter"`
+}
+
+type rpcResponse struct {
+	Result RawMessage `llsd:"result"`
+	Error  *Fault     `llsd:"error"`
+}
+
+// Marshal writes the request as LLSD XML.
+func (r *RPCRequest) Marshal() ([]byte, error) {
+	return MarshalXML(r)
+}
+
+// Unmarshal reads a request from LLSD XML. The parameter is decoded into
+// r.Parameter when it holds a pointer, otherwise as any.
+func (r *RPCRequest) Unmarshal(data []byte) error {
+	var env rpcRequest
+	if err := UnmarshalXML(data, &env); err != nil {
+		return err
+	}
+	r.Method = env.Method
+	return unmarshalRPCValue(env.Parameter, &r.Parameter)
+}
+
+// Marshal writes the response as LLSD XML.
+func (r *RPCResponse) Marshal() ([]byte, error) {
+	return MarshalXML(r)
+}
+
+// Unmarshal reads a response from LLSD XML. The result is decoded into
+// r.Result when it holds a pointer, otherwise as any.
+func (r *RPCResponse) Unmarshal(data []byte) error {
+	var env rpcResponse
+	if err := UnmarshalXML(data, &env); err != nil {
+		return err
+	}
+	r.Error = env.Error
+	return unmarshalRPCValue(env.Result, &r.Result)
+}
+
+// Err returns the fault of the response, or nil if the call succeeded.
+func (r *RPCResponse) Err() error {
+	if r.Error == nil {
+		return nil
+	}
+	return r.Error
+}
+
+// unmarshalRPCValue decodes an envelope value into the pointer held by dst,
+// if any, or into dst itself.
+func unmarshalRPCValue(raw RawMessage, dst *any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if v := reflect.ValueOf(*dst); v.Kind() == reflect.Pointer && !v.IsNil() {
+		return UnmarshalXML(raw, *dst)
+	}
+	*dst = nil
+	return UnmarshalXML(raw, dst)
+}
@@ -0,0 +1,62 @@
+package llsd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRPCRequest(t *testing.T) {
+	type params struct {
+		AgentID UUID   `llsd:"agent_id"`
+		Name    string `llsd:"name"`
+	}
+	src := RPCRequest{Method: "rename", Parameter: params{AgentID: UUID{1}, Name: "Ada"}}
+	b, err := src.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst params
+	req := RPCRequest{Parameter: &dst}
+	if err := req.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "rename" || dst != src.Parameter {
+		t.Fatalf("Expected %v but got %s %v", src, req.Method, dst)
+	}
+
+	// Parameters are decoded as any without a destination
+	req = RPCRequest{}
+	if err := req.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := req.Parameter.(map[string]any); !ok || m["name"] != "Ada" {
+		t.Fatalf("Expected parameter map but got %v", req.Parameter)
+	}
+}
+
+func TestRPCResponse(t *testing.T) {
+	b, err := (&RPCResponse{Result: []int{1, 2}}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res RPCResponse
+	if err := res.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	if res.Err() != nil || !reflect.DeepEqual(res.Result, []any{int32(1), int32(2)}) {
+		t.Fatalf("Expected result [1 2] but got %v, %v", res.Result, res.Err())
+	}
+
+	b, err = (&RPCResponse{Error: &Fault{Message: "no such method", Code: 404}}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = RPCResponse{}
+	if err := res.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	if res.Result != nil || res.Err() == nil || res.Err().Error() != "no such method" || res.Error.Code != 404 {
+		t.Fatalf("Expected fault but got %v, %v", res.Result, res.Err())
+	}
+}
@@ -0,0 +1,176 @@
+package llsd
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Schema declares the expected structure of an LLSD value. A Schema with a
+// non-nil Map describes a map, one with a non-nil Array describes an array,
+// and otherwise it describes a scalar of the given Type. A nil *Schema
+// accepts any value.
+type Schema struct {
+	Type     ScalarType         // Expected scalar type
+	Map      map[string]*Schema // Expected map values by key
+	Required []string           // Keys which must be present in a map
+	Array    *Schema            // Expected array element
+}
+
+// SchemaError describes a value which does not match its schema.
+type SchemaError struct {
+	Path    string // Dot-separated path of the value, "" for the root
+	Problem string
+	Offset  int64 // Input stream byte offset where the problem was found
+}
+
+func (e *SchemaError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "root"
+	}
+	return "LLSD: Schema violation at " + path + ": " + e.Problem
+}
+
+// Validate walks the token stream of a single LLSD value, checking it against
+// the schema without decoding it. All violations are collected and returned
+// along with whether the value is valid. Errors reading tokens stop
+// validation and are returned with any violations found so far.
+func (s *Schema) Validate(r TokenReader) ([]error, bool) {
+	v := validator{r: r}
+	tok, err := r.Token()
+	if err == nil {
+		err = v.value(s, tok, "")
+	}
+	if err != nil {
+		v.errs = append(v.errs, err)
+	}
+	return v.errs, len(v.errs) == 0
+}
+
+type validator struct {
+	r    TokenReader
+	errs []error
+}
+
+// violation records a schema violation.
+func (v *validator) violation(path string, format string, args ...any) {
+	v.errs = append(v.errs, &SchemaError{Path: path, Problem: fmt.Sprintf(format, args...), Offset: v.r.Offset()})
+}
+
+// value validates a value starting with tok. Returned errors are fatal.
+func (v *validator) value(s *Schema, tok Token, path string) error {
+	if s == nil {
+		return skipValue(v.r, tok)
+	}
+	switch tok := tok.(type) {
+	case MapStart:
+		if s.Map == nil {
+			v.violation(path, "expected %s, got map", s.kind())
+			return skipValue(v.r, tok)
+		}
+		return v.object(s, path)
+	case ArrayStart:
+		if s.Array == nil {
+			v.violation(path, "expected %s, got array", s.kind())
+			return skipValue(v.r, tok)
+		}
+		return v.array(s, path)
+	case Scalar:
+		if s.Map != nil || s.Array != nil || tok.Type != s.Type {
+			v.violation(path, "expected %s, got %s", s.kind(), tok.Type)
+		}
+		return nil
+	default:
+		return &InvalidLLSDError{Problem: fmt.Sprintf("unexpected %s", reflect.TypeOf(tok).Name()), Offset: v.r.Offset()}
+	}
+}
+
+func (v *validator) object(s *Schema, path string) error {
+	seen := map[string]bool{}
+	for {
+		tok, err := v.r.Token()
+		if err != nil {
+			return err
+		}
+		var key string
+		switch tok := tok.(type) {
+		case Key:
+			key = string(tok)
+		case MapEnd:
+			for _, key := range s.Required {
+				if !seen[key] {
+					v.violation(path, "missing required key %q", key)
+				}
+			}
+			return nil
+		default:
+			return &InvalidLLSDError{Problem: fmt.Sprintf("expected map to start with key, got %s", reflect.TypeOf(tok).Name()), Offset: v.r.Offset()}
+		}
+		seen[key] = true
+
+		tok, err = v.r.Token()
+		if err != nil {
+			return err
+		}
+		if err = v.value(s.Map[key], tok, joinPath(path, key)); err != nil {
+			return err
+		}
+	}
+}
+
+func (v *validator) array(s *Schema, path string) error {
+	for i := 0; ; i++ {
+		tok, err := v.r.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := tok.(ArrayEnd); ok {
+			return nil
+		}
+		if err = v.value(s.Array, tok, joinPath(path, strconv.Itoa(i))); err != nil {
+			return err
+		}
+	}
+}
+
+// kind describes the LLSD value expected by the schema.
+func (s *Schema) kind() string {
+	switch {
+	case s.Map != nil:
+		return "map"
+	case s.Array != nil:
+		return "array"
+	default:
+		return s.Type.String()
+	}
+}
+
+// joinPath appends a key to a dot-separated path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// skipValue reads past the value starting with tok, including the contents
+// of maps and arrays.
+func skipValue(r TokenReader, tok Token) error {
+	depth := 0
+	for {
+		switch tok.(type) {
+		case MapStart, ArrayStart:
+			depth++
+		case MapEnd, ArrayEnd:
+			depth--
+		}
+		if depth <= 0 {
+			return nil
+		}
+		var err error
+		if tok, err = r.Token(); err != nil {
+			return err
+		}
+	}
+}
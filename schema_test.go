@@ -0,0 +1,45 @@
+package llsd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema := &Schema{
+		Map: map[string]*Schema{
+			"region_id": {Type: UUIDType},
+			"scale":     {Type: String},
+		},
+		Required: []string{"region_id", "scale"},
+	}
+	errs, ok := schema.Validate(NewXMLScanner(strings.NewReader(xmlStr)))
+	if !ok {
+		t.Fatalf("Expected xmlStr to be valid, got %v", errs)
+	}
+
+	schema = &Schema{
+		Map: map[string]*Schema{
+			"scale":                {Type: Integer},
+			"simulator statistics": {Array: &Schema{Type: Real}},
+		},
+		Required: []string{"missing"},
+	}
+	errs, ok = schema.Validate(NewXMLScanner(strings.NewReader(xmlStr)))
+	if ok {
+		t.Fatalf("Expected xmlStr to be invalid")
+	}
+	expected := []string{
+		"LLSD: Schema violation at scale: expected integer, got string",
+		"LLSD: Schema violation at simulator statistics: expected array, got map",
+		"LLSD: Schema violation at root: missing required key \"missing\"",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Fatalf("Expected error \"%s\" but got \"%s\"", expected[i], err)
+		}
+	}
+}
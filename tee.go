@@ -0,0 +1,26 @@
+package llsd
+
+// teeTokenReader passes each token read from r to sink.
+type teeTokenReader struct {
+	r    TokenReader
+	sink func(Token)
+}
+
+// TeeTokenReader returns a TokenReader that reads from r and passes each token
+// it reads to sink, such as to log the tokens seen by an Unmarshaler created
+// with NewDecoder.
+func TeeTokenReader(r TokenReader, sink func(Token)) TokenReader {
+	return &teeTokenReader{r: r, sink: sink}
+}
+
+func (t *teeTokenReader) Token() (Token, error) {
+	tok, err := t.r.Token()
+	if err == nil {
+		t.sink(tok)
+	}
+	return tok, err
+}
+
+func (t *teeTokenReader) Offset() int64 {
+	return t.r.Offset()
+}
@@ -2,15 +2,21 @@ package llsd
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"net"
+	"net/url"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 )
 
 // MarshalTypeError represents an error in the marshaling process.
@@ -27,12 +33,59 @@ type UnmarshalTypeError struct {
 	Value  string       // Description of LLSD value - "real", "map", "string"
 	Type   reflect.Type // Type of Go value that could not be assigned to
 	Offset int64        // Input stream byte offset where error occurred
+	Field  string       // Dot-separated path of the struct field, if known
 }
 
 func (e *UnmarshalTypeError) Error() string {
+	if e.Field != "" {
+		return "LLSD: Cannot unmarshal " + e.Value + " into Go struct field " + e.Field + " of type " + e.Type.String() + "."
+	}
 	return "LLSD: Cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String() + "."
 }
 
+// UnmarshalTypeErrors lists the type errors of values skipped by an
+// Unmarshaler with CollectErrors set.
+type UnmarshalTypeErrors []*UnmarshalTypeError
+
+func (e UnmarshalTypeErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// DecodeError wraps an error decoding the value of a map key, naming the key
+// so that the failing value can be found.
+type DecodeError struct {
+	Key string // Dot-separated path of keys from the outermost map
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return "LLSD: key \"" + e.Key + "\": " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// wrapKey wraps an error decoding the value of key in a DecodeError, or
+// prefixes key to the path of an error already wrapped by a nested map. Type
+// errors naming their struct field are returned as is.
+func wrapKey(key string, err error) error {
+	switch e := err.(type) {
+	case *DecodeError:
+		e.Key = key + "." + e.Key
+		return e
+	case *UnmarshalTypeError:
+		if e.Field != "" {
+			return e
+		}
+	}
+	return &DecodeError{Key: key, Err: err}
+}
+
 // InvalidLLSDError represents a problem with input LLSD.
 type InvalidLLSDError struct {
 	Problem string
@@ -43,13 +96,89 @@ func (e *InvalidLLSDError) Error() string {
 	return "Invalid LLSD: " + e.Problem
 }
 
+// DateUnit is the unit of numeric (integer, real) LLSD values decoded into
+// time.Time.
+type DateUnit int
+
+const (
+	Seconds DateUnit = iota
+	Milliseconds
+	Nanoseconds
+)
+
+// time converts an epoch value in the given unit to time.Time. Nanoseconds
+// are rounded, and time.Unix carries a rounded 1e9 into the next second.
+func (d DateUnit) time(epoch float64) time.Time {
+	switch d {
+	case Milliseconds:
+		sec := math.Floor(epoch / 1e3)
+		return time.Unix(int64(sec), int64(math.Round((epoch-sec*1e3)*1e6)))
+	case Nanoseconds:
+		return time.Unix(0, int64(math.Round(epoch)))
+	default:
+		sec := math.Floor(epoch)
+		return time.Unix(int64(sec), int64(math.Round((epoch-sec)*1e9)))
+	}
+}
+
+// DateMode controls how LLSD dates are decoded into interface values.
+type DateMode int
+
+const (
+	AsTime   DateMode = iota // time.Time
+	AsEpoch                  // float64 seconds since epoch
+	AsString                 // original date text
+)
+
+// DuplicateKeyPolicy controls how keys repeated within a map are decoded.
+type DuplicateKeyPolicy int
+
+const (
+	LastWins       DuplicateKeyPolicy = iota // later values overwrite earlier ones
+	FirstWins                                // later values are skipped
+	DuplicateError                           // decoding fails with an InvalidLLSDError
+)
+
+// DecoderOptions configures an Unmarshaler.
+type DecoderOptions struct {
+	DisallowUnknownFields bool
+	DateUnit              DateUnit           // Unit of numeric values decoded into time.Time
+	DateMode              DateMode           // Type of dates decoded into interface values
+	AcceptCommaDecimal    bool               // Accept a comma decimal separator in text reals, <real>1,5</real>
+	MaxEntries            int                // Maximum entries of a single map or array, 0 for no limit
+	MaxTotalTokens        int                // Maximum tokens in a document, 0 for no limit
+	MaxDecodedBytes       int                // Maximum total bytes of scalar data and keys in a document, 0 for no limit
+	StrictTypes           bool               // Reject conversions between LLSD types, such as binary into int
+	CollectErrors         bool               // Skip values with type errors, returning all as UnmarshalTypeErrors
+	ValidateURIs          bool               // Reject uri values which do not parse as URLs
+	UnwrapSingletonArrays bool               // Decode the only element of an array given for a scalar
+	DuplicateKeys         DuplicateKeyPolicy // Handling of keys repeated within a map
+	// FieldTransform, if set, is called after each struct field is decoded
+	// with the dot-separated field path and the field value, which may be
+	// modified in place.
+	FieldTransform func(path string, v reflect.Value) error
+	// ArrayFill, if set, is called after each fixed-size Go array is decoded
+	// with the dot-separated field path and the number of elements filled,
+	// which is less than the array length when the LLSD array is shorter.
+	ArrayFill func(path string, filled int)
+	// FieldName, if set, names struct fields without a name given by their
+	// tag, such as SnakeCase. It must depend only on the field name.
+	FieldName func(name string) string
+}
+
 // Decoder is a generic LLSD unmarshaler that can work with any TokenReader.
 type Unmarshaler struct {
-	DisallowUnknownFields bool
-	text                  bool // whether decoding text (notation, xml) or binary llsd
-	dec                   scalarDecoder
-	scan                  TokenReader
-	tok                   Token // last read token
+	DecoderOptions
+	path   []string // keys of struct fields being decoded
+	text   bool     // whether decoding text (notation, xml) or binary llsd
+	dec    ScalarDecoder
+	scan   TokenReader
+	tok    Token // last read token
+	tokens int   // number of tokens read
+	bytes  int   // number of scalar and key bytes read
+	depth  int   // number of open maps and arrays
+	errs   UnmarshalTypeErrors
+	named  namedFieldCache // fields named by FieldName
 }
 
 // TextUnmarshaler is the interface implemented by types that want to
@@ -65,6 +194,21 @@ type BinaryUnmarshaler interface {
 	UnmarshalBinaryLLSD([]byte) error
 }
 
+// AttrUnmarshaler is the interface implemented by types that want to receive
+// the attributes of the scalar element they are unmarshaled from, such as
+// lang in <string lang="en">. It is called before the value is unmarshaled,
+// with a nil map for formats without attributes.
+type AttrUnmarshaler interface {
+	UnmarshalLLSDAttrs(map[string]string) error
+}
+
+// AfterUnmarshaler is the interface implemented by types that want to
+// normalize or validate themselves once fully decoded, such as to set derived
+// fields. Errors are returned by Unmarshal.
+type AfterUnmarshaler interface {
+	AfterUnmarshalLLSD() error
+}
+
 // TextMarshaler is the interface implemented by types that want to
 // customize how text (xml, notation) LLSD values are marshaled into
 // text.
@@ -79,6 +223,157 @@ type BinaryMarshaler interface {
 	MarshalBinaryLLSD() (ScalarType, []byte, error)
 }
 
+// LLSDMarshaler is the interface implemented by types that want to write
+// their whole value, including maps and arrays, as a stream of tokens. Scalar
+// data is given in text form.
+type LLSDMarshaler interface {
+	MarshalLLSD(TokenWriter) error
+}
+
+// LLSDUnmarshaler is the interface implemented by types that want to read
+// their whole value from a stream of tokens. The reader returns io.EOF after
+// the last token of the value.
+type LLSDUnmarshaler interface {
+	UnmarshalLLSD(TokenReader) error
+}
+
+var llsdUnmarshalerType = reflect.TypeOf((*LLSDUnmarshaler)(nil)).Elem()
+
+// RawMessage is a raw LLSD XML value without the <llsd> root element. It can
+// be used to delay decoding part of a document, such as a value whose type
+// depends on a sibling key, or to write precomputed LLSD verbatim.
+type RawMessage []byte
+
+// Ways in which a type implements LLSDUnmarshaler
+const (
+	unmarshalerNone    = iota + 1
+	unmarshalerPointer // the type is a pointer implementing it
+	unmarshalerAddr    // a pointer to the type implements it
+)
+
+var unmarshalerCache sync.Map // map[reflect.Type]int
+
+// llsdUnmarshaler returns the LLSDUnmarshaler implemented by v or its address,
+// allocating a nil pointer as needed.
+func llsdUnmarshaler(v reflect.Value) (LLSDUnmarshaler, bool) {
+	if !v.IsValid() {
+		return nil, false
+	}
+	t := v.Type()
+	impl, ok := unmarshalerCache.Load(t)
+	if !ok {
+		switch {
+		case t.Kind() == reflect.Pointer && t.Implements(llsdUnmarshalerType):
+			impl = unmarshalerPointer
+		case reflect.PointerTo(t).Implements(llsdUnmarshalerType):
+			impl = unmarshalerAddr
+		default:
+			impl = unmarshalerNone
+		}
+		unmarshalerCache.Store(t, impl)
+	}
+	switch impl {
+	case unmarshalerPointer:
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return v.Interface().(LLSDUnmarshaler), true
+	case unmarshalerAddr:
+		if v.CanAddr() {
+			return v.Addr().Interface().(LLSDUnmarshaler), true
+		}
+	}
+	return nil, false
+}
+
+// valueReader reads the tokens of the value at the current position of an
+// Unmarshaler, beginning with its already read first token.
+type valueReader struct {
+	u       *Unmarshaler
+	started bool
+	done    bool
+	depth   int
+}
+
+func (r *valueReader) Token() (Token, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	tok := r.u.tok
+	if r.started {
+		var err error
+		if tok, err = r.u.token(); err != nil {
+			return nil, err
+		}
+	}
+	r.started = true
+	switch tok.(type) {
+	case MapStart, ArrayStart:
+		r.depth++
+	case MapEnd, ArrayEnd:
+		r.depth--
+	}
+	r.done = r.depth <= 0
+	return tok, nil
+}
+
+func (r *valueReader) Offset() int64 {
+	return r.u.scan.Offset()
+}
+
+// unmarshalLLSD passes the current value to a custom unmarshaler, then
+// discards any of its tokens left unread.
+func (u *Unmarshaler) unmarshalLLSD(un LLSDUnmarshaler) error {
+	r := &valueReader{u: u}
+	if err := un.UnmarshalLLSD(r); err != nil {
+		return err
+	}
+	for !r.done {
+		if _, err := r.Token(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rawMessage captures the current value as a RawMessage. Tokens of text LLSD
+// are written as read, while values of binary LLSD are decoded and written in
+// their text form.
+func (u *Unmarshaler) rawMessage(v reflect.Value) error {
+	var b bytes.Buffer
+	enc := NewXMLEncoderWith(&b, EncoderOptions{Fragment: true})
+	if u.text {
+		r := &valueReader{u: u}
+		for !r.done {
+			tok, err := r.Token()
+			if err != nil {
+				return err
+			}
+			if err = enc.WriteToken(tok); err != nil {
+				return err
+			}
+		}
+		enc.Flush()
+	} else {
+		var value any
+		if err := u.value(reflect.ValueOf(&value).Elem(), nil); err != nil {
+			return err
+		}
+		if err := enc.Encode(value); err != nil {
+			return err
+		}
+	}
+	v.SetBytes(b.Bytes())
+	return nil
+}
+
+// SetScalarDecoder replaces the decoder used to parse scalar data, which is
+// chosen by format by default. Hexadecimal text integers accepted without
+// StrictTypes are parsed by the Unmarshaler, not passed to dec.
+func (u *Unmarshaler) SetScalarDecoder(dec ScalarDecoder) {
+	u.dec = dec
+}
+
 // Unmarshal decodes LLSD into a given value.
 func (u *Unmarshaler) Unmarshal(v any) error {
 	val := reflect.ValueOf(v)
@@ -86,61 +381,406 @@ func (u *Unmarshaler) Unmarshal(v any) error {
 		return errors.New("Non-pointer passed to Unmarshal")
 	}
 
+	u.reset()
+
 	// Read first value
 	if err := u.next(); err != nil {
 		return err
 	}
 
-	return u.value(val)
+	if err := u.value(val, nil); err != nil {
+		return err
+	}
+	if len(u.errs) > 0 {
+		return u.errs
+	}
+	return nil
+}
+
+// DecodeArray reads an array one element at a time, without holding the whole
+// array in memory. fn is called for each element with a function decoding it
+// into v, which may be reused between elements. Elements fn does not decode are
+// skipped.
+func (u *Unmarshaler) DecodeArray(fn func(decode func(v any) error) error) error {
+	u.reset()
+
+	if err := u.next(); err != nil {
+		return err
+	}
+	if _, ok := u.tok.(ArrayStart); !ok {
+		return &InvalidLLSDError{Problem: fmt.Sprintf("expected array, got %s", reflect.TypeOf(u.tok).Name()), Offset: u.scan.Offset()}
+	}
+	for n := 1; ; n++ {
+		if err := u.next(); err != nil {
+			return err
+		}
+		if _, ok := u.tok.(ArrayEnd); ok {
+			break
+		}
+		if err := u.entries(n, "array"); err != nil {
+			return err
+		}
+
+		decoded := false
+		decode := func(v any) error {
+			if decoded {
+				return errors.New("Array element already decoded")
+			}
+			decoded = true
+			val := reflect.ValueOf(v)
+			if val.Kind() != reflect.Pointer {
+				return errors.New("Non-pointer passed to DecodeArray")
+			}
+			return u.value(val, nil)
+		}
+		if err := fn(decode); err != nil {
+			return err
+		}
+		if !decoded {
+			if err := u.value(reflect.Value{}, nil); err != nil {
+				return err
+			}
+		}
+	}
+	if len(u.errs) > 0 {
+		return u.errs
+	}
+	return nil
+}
+
+// reset discards state left by a previous Unmarshal.
+func (u *Unmarshaler) reset() {
+	u.path = u.path[:0]
+	u.tokens = 0
+	u.bytes = 0
+	u.depth = 0
+	u.errs = nil
+	u.named = nil
 }
 
 // token advances the parser to the next token and returns its value.
 func (u *Unmarshaler) token() (Token, error) {
 	tok, err := u.scan.Token()
 	u.tok = tok
+	if err == nil {
+		switch tok := tok.(type) {
+		case MapStart, ArrayStart:
+			u.depth++
+		case MapEnd, ArrayEnd:
+			u.depth--
+		case Scalar:
+			u.bytes += len(tok.Data)
+		case Key:
+			u.bytes += len(tok)
+		}
+		if u.MaxDecodedBytes > 0 && u.bytes > u.MaxDecodedBytes {
+			return tok, &InvalidLLSDError{Problem: fmt.Sprintf("document exceeds %d bytes of data", u.MaxDecodedBytes), Offset: u.scan.Offset()}
+		}
+		u.tokens++
+		if u.MaxTotalTokens > 0 && u.tokens > u.MaxTotalTokens {
+			return tok, &InvalidLLSDError{Problem: fmt.Sprintf("document exceeds %d tokens", u.MaxTotalTokens), Offset: u.scan.Offset()}
+		}
+	}
 	return tok, err
 }
 
 // next advances the parser to the next token.
 func (u *Unmarshaler) next() error {
-	tok, err := u.scan.Token()
-	u.tok = tok
+	_, err := u.token()
 	return err
 }
 
-// value unmarshals a single value.
-func (u *Unmarshaler) value(v reflect.Value) error {
-	switch u.tok.(type) {
-	case MapStart:
-		if v.IsValid() {
-			if err := u.object(v); err != nil {
+// entries checks the number of entries read from a container against MaxEntries.
+func (u *Unmarshaler) entries(n int, container string) error {
+	if u.MaxEntries > 0 && n > u.MaxEntries {
+		return &InvalidLLSDError{Problem: fmt.Sprintf("%s exceeds %d entries", container, u.MaxEntries), Offset: u.scan.Offset()}
+	}
+	return nil
+}
+
+// value unmarshals a single value. info is the struct field being decoded, if
+// any, for options given by its tag.
+func (u *Unmarshaler) value(v reflect.Value, info *fieldInfo) error {
+	if !u.CollectErrors {
+		return u.decode(v, info)
+	}
+	depth := u.depth
+	_, container := u.tok.(MapStart)
+	if _, ok := u.tok.(ArrayStart); ok {
+		container = true
+	}
+	err := u.decode(v, info)
+	typeErr, ok := err.(*UnmarshalTypeError)
+	if !ok {
+		return err
+	}
+	if typeErr.Field == "" {
+		typeErr.Field = strings.Join(u.path, ".")
+	}
+	u.errs = append(u.errs, typeErr)
+	// Skip the remainder of a container value
+	if container {
+		for u.depth >= depth {
+			if err := u.next(); err != nil {
 				return err
 			}
 		}
+	}
+	return nil
+}
+
+// decode unmarshals a single value, returning the first error.
+func (u *Unmarshaler) decode(v reflect.Value, info *fieldInfo) error {
+	// Use custom unmarshaler of the whole value if present
+	if un, ok := llsdUnmarshaler(v); ok {
+		return u.unmarshalLLSD(un)
+	}
+
+	// Capture raw values for decoding later
+	if v.IsValid() && v.Type() == rawMessageType {
+		return u.rawMessage(v)
+	}
+
+	// Struct expected but got another shape, use its fallback field if any
+	dst := v
+	if _, ok := u.tok.(MapStart); !ok && v.IsValid() {
+		if fallback, ok := fallbackField(v); ok {
+			v = fallback
+		}
+	}
+
+	switch u.tok.(type) {
+	case MapStart:
+		if !v.IsValid() {
+			return u.skip()
+		}
+		if isScalarType(v.Type()) {
+			return &UnmarshalTypeError{Value: "map", Type: v.Type(), Offset: u.scan.Offset(), Field: strings.Join(u.path, ".")}
+		}
+		if err := u.constrain(v, info, "map"); err != nil {
+			return err
+		}
+		if err := u.object(v, info); err != nil {
+			return err
+		}
 	case ArrayStart:
-		if v.IsValid() {
-			if err := u.array(v); err != nil {
-				return err
+		if !v.IsValid() {
+			return u.skip()
+		}
+		if isScalarType(v.Type()) {
+			if u.UnwrapSingletonArrays {
+				return u.singleton(v, info)
 			}
+			return &UnmarshalTypeError{Value: "array", Type: v.Type(), Offset: u.scan.Offset(), Field: strings.Join(u.path, ".")}
+		}
+		if err := u.constrain(v, info, "array"); err != nil {
+			return err
+		}
+		if err := u.array(v, info); err != nil {
+			return err
 		}
 	case Scalar:
 		if v.IsValid() {
-			if err := u.scalar(v); err != nil {
+			if err := u.scalar(v, info); err != nil {
 				return err
 			}
 		}
 	default:
 		return &InvalidLLSDError{Problem: fmt.Sprintf("unexpected %s", reflect.TypeOf(u.tok).Name()), Offset: u.scan.Offset()}
 	}
+	return afterUnmarshal(dst)
+}
+
+// constrain checks a value of the named LLSD type, such as "map" or "real",
+// against the type its field is constrained to by a type= tag. Constrained
+// fields reject all other types, even undef.
+func (u *Unmarshaler) constrain(v reflect.Value, info *fieldInfo, name string) error {
+	if info == nil || info.LLSDTag.Type == "" {
+		return nil
+	}
+	if _, err := ParseScalarType(info.LLSDTag.Type); err != nil {
+		return fmt.Errorf("LLSD: %w", err)
+	}
+	if info.LLSDTag.Type == name {
+		return nil
+	}
+	return &UnmarshalTypeError{Value: name, Type: v.Type(), Offset: u.scan.Offset(), Field: strings.Join(u.path, ".")}
+}
+
+// afterUnmarshal calls the AfterUnmarshalLLSD hook of v, a fully decoded
+// value, if it has one.
+func afterUnmarshal(v reflect.Value) error {
+	if !v.IsValid() || v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil
+	}
+	if v.Kind() != reflect.Pointer && v.CanAddr() {
+		// Allow pointer receivers on addressable values such as struct fields
+		v = v.Addr()
+	}
+	if !v.CanInterface() {
+		return nil
+	}
+	if hook, ok := v.Interface().(AfterUnmarshaler); ok {
+		return hook.AfterUnmarshalLLSD()
+	}
+	return nil
+}
+
+// extra decodes the value of an unknown key into the map of a field tagged
+// `llsd:",extras"` as the map's element type, such as RawMessage to capture it
+// undecoded or any to decode it with its LLSD type.
+func (u *Unmarshaler) extra(extras reflect.Value, key string) error {
+	ty := extras.Type()
+	if ty.Kind() != reflect.Map || ty.Key().Kind() != reflect.String {
+		return &UnmarshalTypeError{Value: "map", Type: ty, Offset: u.scan.Offset()}
+	}
+	if extras.IsNil() {
+		extras.Set(reflect.MakeMap(ty))
+	}
+	subv := reflect.New(ty.Elem()).Elem()
+	if err := u.value(subv, nil); err != nil {
+		return err
+	}
+	extras.SetMapIndex(reflect.ValueOf(key).Convert(ty.Key()), subv)
+	return nil
+}
+
+// singleton decodes the only element of an array into a scalar destination,
+// as written by producers which wrap single values in arrays.
+func (u *Unmarshaler) singleton(v reflect.Value, info *fieldInfo) error {
+	if err := u.next(); err != nil {
+		return err
+	}
+	if _, ok := u.tok.(ArrayEnd); ok {
+		return &UnmarshalTypeError{Value: "empty array", Type: v.Type(), Offset: u.scan.Offset(), Field: strings.Join(u.path, ".")}
+	}
+	if err := u.value(v, info); err != nil {
+		return err
+	}
+	if err := u.next(); err != nil {
+		return err
+	}
+	if _, ok := u.tok.(ArrayEnd); !ok {
+		return &UnmarshalTypeError{Value: "array of more than one element", Type: v.Type(), Offset: u.scan.Offset(), Field: strings.Join(u.path, ".")}
+	}
+	return nil
+}
+
+// seenKeys returns a set for tracking the keys of a map being decoded, or nil
+// when duplicate keys need not be detected.
+func (u *Unmarshaler) seenKeys() map[string]struct{} {
+	if u.DuplicateKeys == LastWins {
+		return nil
+	}
+	return map[string]struct{}{}
+}
+
+// duplicate applies DuplicateKeys to a key of a map being decoded, reporting
+// whether its value should be skipped.
+func (u *Unmarshaler) duplicate(seen map[string]struct{}, key string) (bool, error) {
+	if seen == nil {
+		return false, nil
+	}
+	if _, ok := seen[key]; !ok {
+		seen[key] = struct{}{}
+		return false, nil
+	}
+	if u.DuplicateKeys == DuplicateError {
+		return false, &InvalidLLSDError{Problem: fmt.Sprintf("duplicate key %q", key), Offset: u.scan.Offset()}
+	}
+	return true, nil
+}
+
+// skip discards the map or array the parser is positioned at.
+func (u *Unmarshaler) skip() error {
+	for depth := 1; depth > 0; {
+		tok, err := u.token()
+		if err != nil {
+			return err
+		}
+		switch tok.(type) {
+		case MapStart, ArrayStart:
+			depth++
+		case MapEnd, ArrayEnd:
+			depth--
+		}
+	}
 	return nil
 }
 
+// fallbackKey is the fieldInfoMap key of the field tagged `llsd:",fallback"`.
+// Tag names cannot contain commas so it will not collide with regular fields.
+const fallbackKey = ",fallback"
+
+// restKey is the fieldInfoMap key of the field tagged `llsd:",rest"`.
+const restKey = ",rest"
+
+// extrasKey is the fieldInfoMap key of the field tagged `llsd:",extras"`.
+const extrasKey = ",extras"
+
+// fallbackField returns the fallback field of v, a struct or pointer to
+// struct, allocating pointers as needed.
+func fallbackField(v reflect.Value) (reflect.Value, bool) {
+	t := v.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return v, false
+	}
+	field, ok := cachedFieldsForType(t)[fallbackKey]
+	if !ok {
+		return v, false
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v.FieldByIndex(field.Index), true
+}
+
+// isScalarType reports whether t (or the type it points to) can only hold a
+// scalar LLSD value.
+func isScalarType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
 // tag stores information parsed from the llsd field tag.
 type tag struct {
 	Encoding  string // Binary field text encoding, base16, base64, base85
 	Name      string // Override Go member name `llsd:"name"`
 	Omit      bool
 	OmitEmpty bool
+	Real      bool   // Emit text form of value as real `llsd:",real"`
+	Pairs     bool   // Map represented as array of key/value arrays `llsd:",pairs"`
+	Attrs     bool   // Field receives XML attributes of a value `llsd:"name,attrs"`
+	Codec     string // Name of registered codec applied to scalar data `llsd:",decode=name"`
+	Encoder   string // Name of registered codec applied when writing `llsd:",encode=name"`
+	Fallback  bool   // Field receives values which are not maps `llsd:",fallback"`
+	Rest      bool   // Slice field receives array elements beyond positional fields `llsd:",rest"`
+	Extras    bool   // Map field receives the values of unknown keys `llsd:",extras"`
+	IntArray  bool   // Byte slice or array is written as array of integers rather than binary `llsd:",intarray"`
+	Numeric   bool   // Numeric field accepts both integer and real values `llsd:",numeric"`
+	Epoch     bool   // Time field is written as real seconds since epoch `llsd:",epoch"`
+	Index     int    // Array position of field in a tuple struct `llsd:",index=0"`
+	Indexed   bool   // Index was given, making the struct a tuple written as array
+	Packed    bool   // Struct of fixed-size fields is packed big-endian into binary `llsd:",packed"`
+	Type      string // Only scalars of the named LLSD type are decoded `llsd:",type=string"`
 }
 
 // parseTag parses a llsd or json field tag.
@@ -156,13 +796,62 @@ func parseTag(t, name string) tag {
 		name = values[0]
 	}
 	omitEmpty := false
-	encoding := Base16
+	real := false
+	pairs := false
+	attrs := false
+	codec := ""
+	encoder := ""
+	fallback := false
+	rest := false
+	extras := false
+	intArray := false
+	numeric := false
+	epoch := false
+	index := 0
+	indexed := false
+	packed := false
+	scalarType := ""
+	encoding := "" // Unset, use encoder default
 	if len(values) > 1 {
 		for _, v := range values[1:] {
 			switch v {
 			case "omitempty":
 				omitEmpty = true
-			case Base16, Base64, Base85:
+			case "real":
+				real = true
+			case "pairs":
+				pairs = true
+			case "attrs":
+				attrs = true
+			case "fallback":
+				fallback = true
+			case "rest":
+				rest = true
+			case "extras":
+				extras = true
+			case "intarray":
+				intArray = true
+			case "numeric":
+				numeric = true
+			case "epoch":
+				epoch = true
+			case "packed":
+				packed = true
+			default:
+				if strings.HasPrefix(v, "decode=") {
+					codec = strings.TrimPrefix(v, "decode=")
+				} else if strings.HasPrefix(v, "encode=") {
+					encoder = strings.TrimPrefix(v, "encode=")
+				} else if strings.HasPrefix(v, "type=") {
+					// Unknown names are reported when the field is decoded
+					scalarType = strings.TrimPrefix(v, "type=")
+				} else if strings.HasPrefix(v, "index=") {
+					if i, err := strconv.Atoi(strings.TrimPrefix(v, "index=")); err == nil && i >= 0 {
+						index = i
+						indexed = true
+					}
+				}
+			case Base16, Base64, Base64URL, Base85:
 				encoding = v
 			}
 		}
@@ -171,34 +860,80 @@ func parseTag(t, name string) tag {
 		Name:      name,
 		OmitEmpty: omitEmpty,
 		Encoding:  encoding,
+		Real:      real,
+		Pairs:     pairs,
+		Attrs:     attrs,
+		Codec:     codec,
+		Encoder:   encoder,
+		Fallback:  fallback,
+		Rest:      rest,
+		Extras:    extras,
+		IntArray:  intArray,
+		Numeric:   numeric,
+		Epoch:     epoch,
+		Index:     index,
+		Indexed:   indexed,
+		Packed:    packed,
+		Type:      scalarType,
 	}
 }
 
 type fieldInfo struct {
 	reflect.StructField
 	LLSDTag tag
+	basic   bool // predeclared scalar type, which has no custom unmarshaler
 }
 
 type fieldInfoMap map[string]fieldInfo
 
 // fieldsForType collects field information from structs, parsing llsd/json tag information
-// for use during deserialization/serialization
-func fieldsForType(t reflect.Type) fieldInfoMap {
+// for use during deserialization/serialization. A field's llsd tag, when present, fully
+// overrides its json tag: name and options are never merged from both. Fields without a
+// name given by their tag are named by fieldName, if not nil.
+func fieldsForType(t reflect.Type, fieldName func(string) string) fieldInfoMap {
 	fields := fieldInfoMap{}
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 
-		tagStr := field.Tag.Get("llsd")
-		if tagStr == "" {
+		tagStr, ok := field.Tag.Lookup("llsd")
+		if !ok {
 			tagStr = field.Tag.Get("json")
 		}
 
-		tag := parseTag(tagStr, field.Name)
-		fields[tag.Name] = fieldInfo{field, tag}
+		name := field.Name
+		if fieldName != nil && strings.SplitN(tagStr, ",", 2)[0] == "" {
+			name = fieldName(name)
+		}
+		tag := parseTag(tagStr, name)
+		if tag.Attrs {
+			fields[attrsKey(tag.Name)] = fieldInfo{field, tag, false}
+			continue
+		}
+		if tag.Fallback {
+			fields[fallbackKey] = fieldInfo{field, tag, false}
+			continue
+		}
+		if tag.Rest {
+			fields[restKey] = fieldInfo{field, tag, false}
+			continue
+		}
+		if tag.Extras {
+			fields[extrasKey] = fieldInfo{field, tag, false}
+			continue
+		}
+		basic := field.Type.Kind() != reflect.Pointer && field.Type.PkgPath() == "" && isScalarType(field.Type) && tag.Type == ""
+		fields[tag.Name] = fieldInfo{field, tag, basic}
 	}
 	return fields
 }
 
+// attrsKey returns the fieldInfoMap key of the field receiving attributes of
+// the value with the given key. Tag names cannot contain commas so it will not
+// collide with regular fields.
+func attrsKey(key string) string {
+	return key + ",attrs"
+}
+
 var fieldCache sync.Map // map[reflect.Type]fieldInfo
 
 // cachedFieldsForType retrieves cached field information of a type or constructs it if not found
@@ -206,12 +941,129 @@ func cachedFieldsForType(t reflect.Type) fieldInfoMap {
 	if f, ok := fieldCache.Load(t); ok {
 		return f.(fieldInfoMap)
 	}
-	f, _ := fieldCache.LoadOrStore(t, fieldsForType(t))
+	f, _ := fieldCache.LoadOrStore(t, fieldsForType(t, nil))
 	return f.(fieldInfoMap)
 }
 
-// Unmarshal an object.
-func (u *Unmarshaler) object(v reflect.Value) error {
+// namedFieldCache holds field information built with a FieldName function
+// during one Encode or Unmarshal call. Functions cannot be compared, and
+// closures share a code pointer, so it is never shared between calls.
+type namedFieldCache map[reflect.Type]fieldInfoMap
+
+// fieldsForType retrieves field information of a type with untagged fields
+// named by fieldName, which may be nil.
+func (c *namedFieldCache) fieldsForType(t reflect.Type, fieldName func(string) string) fieldInfoMap {
+	if fieldName == nil {
+		return cachedFieldsForType(t)
+	}
+	if f, ok := (*c)[t]; ok {
+		return f
+	}
+	if *c == nil {
+		*c = namedFieldCache{}
+	}
+	f := fieldsForType(t, fieldName)
+	(*c)[t] = f
+	return f
+}
+
+// SnakeCase converts a Go field name to snake case, such as RegionID to
+// region_id, for use as a FieldName option.
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			// Start a word after a lower case letter or digit, or at the last
+			// capital of an acronym followed by a lower case letter
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// maxTupleIndex bounds the position given by an index tag, so that a
+// mistaken tag cannot allocate a huge slice of fields.
+const maxTupleIndex = 1024
+
+// tupleFields is the cached result of tupleFieldsForType.
+type tupleFields struct {
+	fields []fieldInfo
+	err    error
+}
+
+var tupleFieldCache sync.Map // map[reflect.Type]tupleFields
+
+// cachedTupleFieldsForType retrieves the fields of a struct which receive
+// array elements, by position. Fields are positioned in declaration order,
+// each following the previous field unless given a position with an index
+// tag. Positions without a field hold the zero fieldInfo. Fields sharing a
+// position or indexed beyond maxTupleIndex are reported as an error.
+func cachedTupleFieldsForType(t reflect.Type) ([]fieldInfo, error) {
+	if f, ok := tupleFieldCache.Load(t); ok {
+		return f.(tupleFields).fields, f.(tupleFields).err
+	}
+	fields, err := tupleFieldsForType(t)
+	f, _ := tupleFieldCache.LoadOrStore(t, tupleFields{fields, err})
+	return f.(tupleFields).fields, f.(tupleFields).err
+}
+
+// tupleFieldsForType positions the fields of a struct for
+// cachedTupleFieldsForType.
+func tupleFieldsForType(t reflect.Type) ([]fieldInfo, error) {
+	var declared []fieldInfo
+	for key, field := range cachedFieldsForType(t) {
+		// Skip attrs, fallback and rest fields
+		if strings.Contains(key, ",") || field.LLSDTag.Omit || !field.IsExported() {
+			continue
+		}
+		declared = append(declared, field)
+	}
+	sort.Slice(declared, func(i, j int) bool { return declared[i].Index[0] < declared[j].Index[0] })
+	var fields []fieldInfo
+	pos := 0
+	for _, field := range declared {
+		if field.LLSDTag.Indexed {
+			pos = field.LLSDTag.Index
+		}
+		if pos > maxTupleIndex {
+			return nil, fmt.Errorf("LLSD: array index %d of field %s of %s exceeds %d", pos, field.Name, t, maxTupleIndex)
+		}
+		for len(fields) <= pos {
+			fields = append(fields, fieldInfo{})
+		}
+		if fields[pos].Type != nil {
+			return nil, fmt.Errorf("LLSD: fields %s and %s of %s share array index %d", fields[pos].Name, field.Name, t, pos)
+		}
+		fields[pos] = field
+		pos++
+	}
+	return fields, nil
+}
+
+// isTupleStruct reports whether the struct type t has fields tagged with an
+// array index, and so is written as an array.
+func isTupleStruct(t reflect.Type) bool {
+	fields, err := cachedTupleFieldsForType(t)
+	if err != nil {
+		// Only index tags cause errors, reported when the tuple is written
+		return true
+	}
+	for _, field := range fields {
+		if field.LLSDTag.Indexed {
+			return true
+		}
+	}
+	return false
+}
+
+// Unmarshal an object. info is the struct field being decoded, if any.
+func (u *Unmarshaler) object(v reflect.Value, info *fieldInfo) error {
 
 	if v.Kind() == reflect.Pointer {
 		if v.IsNil() {
@@ -221,10 +1073,22 @@ func (u *Unmarshaler) object(v reflect.Value) error {
 	}
 
 	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return &UnmarshalTypeError{Value: "object", Type: v.Type(), Offset: u.scan.Offset()}
+		}
+		// Decode into empty interface as map[string]any
+		newv := reflect.New(reflect.TypeOf(map[string]any{})).Elem()
+		if err := u.object(newv, info); err != nil {
+			return err
+		}
+		v.Set(newv)
+		return nil
 	case reflect.Struct:
-		fields := cachedFieldsForType(v.Type())
+		fields := u.named.fieldsForType(v.Type(), u.FieldName)
+		seen := u.seenKeys()
 
-		for {
+		for n := 1; ; n++ {
 			// Read next key
 			var key string
 			tok, err := u.token()
@@ -241,70 +1105,216 @@ func (u *Unmarshaler) object(v reflect.Value) error {
 			default:
 				return &InvalidLLSDError{Problem: fmt.Sprintf("expected map to start with key, got %s", reflect.TypeOf(tok).Name()), Offset: u.scan.Offset()}
 			}
+			if err = u.entries(n, "map"); err != nil {
+				return err
+			}
+
+			// Advance to presumed value
+			if err = u.next(); err != nil {
+				return err
+			}
+			skip, err := u.duplicate(seen, key)
+			if err != nil {
+				return err
+			}
+			if skip {
+				if err = u.value(reflect.Value{}, nil); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// Capture attributes of the value if requested
+			if attrs, ok := fields[attrsKey(key)]; ok {
+				if err = u.attrs(v.FieldByIndex(attrs.Index)); err != nil {
+					return err
+				}
+			}
 
 			// Find field cooresponding to key
 			field, ok := fields[key]
 			if !ok {
+				// Collect unknown keys into the extras field if any
+				if extras, ok := fields[extrasKey]; ok {
+					if err = u.extra(v.FieldByIndex(extras.Index), key); err != nil {
+						return wrapKey(key, err)
+					}
+					continue
+				}
 				if u.DisallowUnknownFields {
 					return fmt.Errorf("LLSD: Unknown field %q", key)
 				}
-				// Skip unknown field (And possibly skip past invalid JSON...)
-				if err = u.next(); err != nil {
+				// Skip unknown field, including any nested values
+				if err = u.value(reflect.Value{}, nil); err != nil {
 					return err
 				}
 				continue
 			}
 
+			subv := v.FieldByIndex(field.Index)
+			u.path = append(u.path, key)
+			if field.LLSDTag.Codec != "" {
+				if err = u.decodeCodec(field.LLSDTag.Codec); err != nil {
+					return err
+				}
+			}
+			if _, ok := u.tok.(ArrayStart); ok && field.LLSDTag.Pairs {
+				err = u.pairs(subv, &field)
+			} else if tok, ok := u.tok.(Scalar); ok && field.basic && !u.CollectErrors {
+				err = u.basic(subv, tok, &field)
+			} else {
+				err = u.value(subv, &field)
+			}
+			if err != nil {
+				if typeErr, ok := err.(*UnmarshalTypeError); ok && typeErr.Field == "" {
+					typeErr.Field = strings.Join(u.path, ".")
+				}
+				return wrapKey(key, err)
+			}
+			if u.FieldTransform != nil {
+				if err = u.FieldTransform(strings.Join(u.path, "."), subv); err != nil {
+					return err
+				}
+			}
+			u.path = u.path[:len(u.path)-1]
+		}
+	case reflect.Map:
+		ty := v.Type()
+		kType := ty.Key()
+		vType := ty.Elem()
+		if kType.Kind() != reflect.String {
+			return &UnmarshalTypeError{Value: "map ", Type: ty, Offset: u.scan.Offset()}
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(ty))
+		}
+		seen := u.seenKeys()
+		for n := 1; ; n++ {
+			// Read next key
+			var key string
+			tok, err := u.token()
+			if err != nil {
+				return err
+			}
+
+			switch tok := tok.(type) {
+			case Key:
+				key = string(tok)
+			case MapEnd:
+				// Done reading object
+				return nil
+			default:
+				return &InvalidLLSDError{Problem: fmt.Sprintf("expected map to start with key, got %s", reflect.TypeOf(tok).Name()), Offset: u.scan.Offset()}
+			}
+			if err = u.entries(n, "map"); err != nil {
+				return err
+			}
+
 			// Advance to presumed value and use it
+			subv := reflect.New(vType).Elem()
 			if err = u.next(); err != nil {
 				return err
 			}
-			subv := v.FieldByIndex(field.Index)
-			if err = u.value(subv); err != nil {
+			skip, err := u.duplicate(seen, key)
+			if err != nil {
 				return err
 			}
+			if skip {
+				if err = u.value(reflect.Value{}, nil); err != nil {
+					return err
+				}
+				continue
+			}
+			if err = u.value(subv, nil); err != nil {
+				return wrapKey(key, err)
+			}
+			// Convert to named string key types
+			v.SetMapIndex(reflect.ValueOf(key).Convert(kType), subv)
+		}
+	default:
+		return &UnmarshalTypeError{Value: "object", Type: v.Type(), Offset: u.scan.Offset()}
+	}
+}
+
+// attrs stores the XML attributes of the current value, if it is a scalar, in v.
+func (u *Unmarshaler) attrs(v reflect.Value) error {
+	scalar, ok := u.tok.(Scalar)
+	if !ok {
+		return nil
+	}
+	attrs := reflect.ValueOf(scalar.Attr)
+	if !attrs.Type().AssignableTo(v.Type()) {
+		return &UnmarshalTypeError{Value: "attributes", Type: v.Type(), Offset: u.scan.Offset(), Field: strings.Join(u.path, ".")}
+	}
+	v.Set(attrs)
+	return nil
+}
+
+// pairs unmarshals an array of two-element key/value arrays into a map. info
+// is the struct field being decoded.
+func (u *Unmarshaler) pairs(v reflect.Value, info *fieldInfo) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Map {
+		return &UnmarshalTypeError{Value: "array", Type: v.Type(), Offset: u.scan.Offset(), Field: strings.Join(u.path, ".")}
+	}
+	ty := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(ty))
+	}
+	for n := 1; ; n++ {
+		tok, err := u.token()
+		if err != nil {
+			return err
+		}
+		switch tok.(type) {
+		case ArrayEnd:
+			// Done reading pairs
+			return nil
+		case ArrayStart:
+		default:
+			return &InvalidLLSDError{Problem: fmt.Sprintf("expected key/value pair array, got %s", reflect.TypeOf(tok).Name()), Offset: u.scan.Offset()}
+		}
+		if err = u.entries(n, "array"); err != nil {
+			return err
+		}
+
+		key := reflect.New(ty.Key()).Elem()
+		if err = u.next(); err != nil {
+			return err
 		}
-	case reflect.Map:
-		ty := v.Type()
-		kType := ty.Key()
-		vType := ty.Elem()
-		if kType.Kind() != reflect.String {
-			return &UnmarshalTypeError{Value: "map ", Type: ty, Offset: u.scan.Offset()}
+		if _, ok := u.tok.(Scalar); !ok {
+			return &InvalidLLSDError{Problem: fmt.Sprintf("expected scalar pair key, got %s", reflect.TypeOf(u.tok).Name()), Offset: u.scan.Offset()}
+		}
+		if err = u.scalar(key, nil); err != nil {
+			return err
 		}
-		for {
-			// Read next key
-			var key string
-			tok, err := u.token()
-			if err != nil {
-				return err
-			}
 
-			switch tok := tok.(type) {
-			case Key:
-				key = string(tok)
-			case MapEnd:
-				// Done reading object
-				return nil
-			default:
-				return &InvalidLLSDError{Problem: fmt.Sprintf("expected map to start with key, got %s", reflect.TypeOf(tok).Name()), Offset: u.scan.Offset()}
-			}
+		subv := reflect.New(ty.Elem()).Elem()
+		if err = u.next(); err != nil {
+			return err
+		}
+		if err = u.value(subv, nil); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, subv)
 
-			// Advance to presumed value and use it
-			subv := reflect.New(vType).Elem()
-			if err = u.next(); err != nil {
-				return err
-			}
-			if err = u.value(subv); err != nil {
-				return err
-			}
-			v.SetMapIndex(reflect.ValueOf(key), subv)
+		tok, err = u.token()
+		if err != nil {
+			return err
+		}
+		if _, ok := tok.(ArrayEnd); !ok {
+			return &InvalidLLSDError{Problem: "expected key/value pair array to have two elements", Offset: u.scan.Offset()}
 		}
-	default:
-		return &UnmarshalTypeError{Value: "object", Type: v.Type(), Offset: u.scan.Offset()}
 	}
 }
 
-func (u *Unmarshaler) array(v reflect.Value) error {
+// Unmarshal an array. info is the struct field being decoded, if any.
+func (u *Unmarshaler) array(v reflect.Value, info *fieldInfo) error {
 	if v.Kind() == reflect.Pointer {
 		if v.IsNil() {
 			v.Set(reflect.New(v.Type().Elem()))
@@ -314,16 +1324,28 @@ func (u *Unmarshaler) array(v reflect.Value) error {
 
 	switch v.Kind() {
 	case reflect.Interface:
-		if v.NumMethod() == 0 {
-			// Decode into nil interface
-			newv := reflect.ValueOf([]any{})
-			v.Set(newv)
-			if err := u.array(newv); err != nil {
-				return err
-			}
+		if v.NumMethod() != 0 {
+			return &UnmarshalTypeError{Value: "array", Type: v.Type(), Offset: u.scan.Offset()}
+		}
+		// Decode into empty interface as []any, or as the slice type it
+		// already holds if the caller provided one as a hint
+		ty := reflect.TypeOf([]any{})
+		if !v.IsNil() && v.Elem().Kind() == reflect.Slice {
+			ty = v.Elem().Type()
+		}
+		newv := reflect.New(ty).Elem()
+		if err := u.array(newv, info); err != nil {
+			return err
 		}
-		fallthrough
+		v.Set(newv)
+		return nil
+	case reflect.Struct:
+		return u.tuple(v)
 	case reflect.Slice, reflect.Array:
+		// Empty arrays result in an empty, rather than nil, slice
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		}
 		i := 0
 		for {
 			// Read next value
@@ -334,9 +1356,23 @@ func (u *Unmarshaler) array(v reflect.Value) error {
 
 			switch tok.(type) {
 			case ArrayEnd:
-				// Done reading array
+				// Done reading array, dropping elements of a reused slice
+				// beyond those decoded
+				if v.Kind() == reflect.Slice && i < v.Len() {
+					v.SetLen(i)
+				}
+				if v.Kind() == reflect.Array && u.ArrayFill != nil {
+					filled := i
+					if filled > v.Len() {
+						filled = v.Len()
+					}
+					u.ArrayFill(strings.Join(u.path, "."), filled)
+				}
 				return nil
 			}
+			if err = u.entries(i+1, "array"); err != nil {
+				return err
+			}
 
 			// grow slice
 			if v.Kind() == reflect.Slice {
@@ -350,18 +1386,20 @@ func (u *Unmarshaler) array(v reflect.Value) error {
 					v.Set(newv)
 				}
 				if i >= v.Len() {
+					// Clear stale values left in the backing array
 					v.SetLen(i + 1)
+					v.Index(i).Set(reflect.Zero(v.Type().Elem()))
 				}
 			}
 
 			if i < v.Len() {
 				// Decode into value
-				if err := u.value(v.Index(i)); err != nil {
+				if err := u.value(v.Index(i), nil); err != nil {
 					return err
 				}
 			} else {
 				// Skip remaining elements (fixed array)
-				if err := u.value(reflect.Value{}); err != nil {
+				if err := u.value(reflect.Value{}, nil); err != nil {
 					return err
 				}
 			}
@@ -372,16 +1410,126 @@ func (u *Unmarshaler) array(v reflect.Value) error {
 	}
 }
 
-func (u *Unmarshaler) scalar(v reflect.Value) error {
-	// Use custom unmarshaler if present
+// tuple unmarshals an array into the fields of a struct in declaration order.
+// Elements beyond those fields are appended to the rest field, if any, or
+// skipped.
+func (u *Unmarshaler) tuple(v reflect.Value) error {
+	fields, err := cachedTupleFieldsForType(v.Type())
+	if err != nil {
+		return err
+	}
+	var rest reflect.Value
+	if field, ok := cachedFieldsForType(v.Type())[restKey]; ok {
+		rest = v.FieldByIndex(field.Index)
+		if rest.Kind() != reflect.Slice {
+			return &UnmarshalTypeError{Value: "array", Type: rest.Type(), Offset: u.scan.Offset(), Field: strings.Join(u.path, ".")}
+		}
+		rest.Set(reflect.MakeSlice(rest.Type(), 0, 0))
+	}
+	// Structs without positional fields cannot hold an array
+	if len(fields) == 0 && !rest.IsValid() {
+		return &UnmarshalTypeError{Value: "array", Type: v.Type(), Offset: u.scan.Offset(), Field: strings.Join(u.path, ".")}
+	}
+	for i := 0; ; i++ {
+		tok, err := u.token()
+		if err != nil {
+			return err
+		}
+		if _, ok := tok.(ArrayEnd); ok {
+			// Done reading array
+			return nil
+		}
+		if err = u.entries(i+1, "array"); err != nil {
+			return err
+		}
+
+		var subv reflect.Value
+		var info *fieldInfo
+		if i < len(fields) {
+			// Positions without a field are skipped
+			if fields[i].Type != nil {
+				subv = v.FieldByIndex(fields[i].Index)
+				info = &fields[i]
+			}
+		} else if rest.IsValid() {
+			rest.Set(reflect.Append(rest, reflect.Zero(rest.Type().Elem())))
+			subv = rest.Index(rest.Len() - 1)
+		}
+		if err = u.value(subv, info); err != nil {
+			return err
+		}
+	}
+}
+
+// basic decodes a scalar into a struct field of a predeclared scalar type,
+// assigning values of the matching LLSD type without the checks for custom
+// unmarshalers made by value. Conversions are left to scalar.
+func (u *Unmarshaler) basic(v reflect.Value, tok Scalar, info *fieldInfo) error {
+	switch v.Kind() {
+	case reflect.String:
+		if tok.Type == String {
+			v.SetString(string(tok.Data))
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if tok.Type == Integer {
+			value, err := u.integer(tok.Data)
+			if err != nil {
+				return err
+			}
+			if !v.OverflowInt(value) {
+				v.SetInt(value)
+				return nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if tok.Type == Real {
+			value, err := u.real(tok.Data)
+			if err != nil {
+				return err
+			}
+			if !v.OverflowFloat(value) {
+				v.SetFloat(value)
+				return nil
+			}
+		}
+	case reflect.Bool:
+		if tok.Type == Boolean {
+			value, err := u.dec.Boolean(tok.Data)
+			if err != nil {
+				return err
+			}
+			v.SetBool(value)
+			return nil
+		}
+	}
+	return u.scalar(v, info)
+}
+
+func (u *Unmarshaler) scalar(v reflect.Value, info *fieldInfo) error {
 	tok := u.tok.(Scalar)
+	if err := u.constrain(v, info, tok.Type.String()); err != nil {
+		return err
+	}
+
+	// Use custom unmarshaler if present
+	iface := v.Interface()
+	if v.Kind() != reflect.Pointer && v.CanAddr() {
+		// Allow pointer receivers on addressable values such as struct fields
+		iface = v.Addr().Interface()
+	}
+	if un, ok := iface.(AttrUnmarshaler); ok {
+		if err := un.UnmarshalLLSDAttrs(tok.Attr); err != nil {
+			return err
+		}
+	}
 	if u.text {
-		un, ok := v.Interface().(TextUnmarshaler)
+		un, ok := iface.(TextUnmarshaler)
 		if ok {
 			return un.UnmarshalTextLLSD(tok.Data)
 		}
 	} else {
-		un, ok := v.Interface().(BinaryUnmarshaler)
+		un, ok := iface.(BinaryUnmarshaler)
 		if ok {
 			return un.UnmarshalBinaryLLSD(tok.Data)
 		}
@@ -399,11 +1547,43 @@ func (u *Unmarshaler) scalar(v reflect.Value) error {
 		v = v.Elem()
 	}
 
+	// Use database/sql scanners such as sql.NullString, passing undef as NULL
+	if v.CanAddr() {
+		if sc, ok := v.Addr().Interface().(sql.Scanner); ok {
+			var value any
+			if tok.Type != Undefined {
+				if err := u.scalar(reflect.ValueOf(&value).Elem(), info); err != nil {
+					return err
+				}
+			}
+			return sc.Scan(value)
+		}
+	}
+
+	// Decode arbitrary precision numbers
+	if ok, err := u.big(v, tok); ok {
+		return err
+	}
+
+	// Durations are integer nanoseconds or real seconds
+	if v.Type() == durationType && tok.Type == Real {
+		value, err := u.real(tok.Data)
+		if err != nil {
+			return err
+		}
+		ns := math.Round(value * float64(time.Second))
+		if math.IsNaN(ns) || ns < -(1<<63) || ns >= 1<<63 {
+			return &UnmarshalTypeError{Value: "real " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+		}
+		v.SetInt(int64(ns))
+		return nil
+	}
+
 	switch tok.Type {
 	case Real:
 		switch v.Kind() {
 		case reflect.Float32, reflect.Float64:
-			value, err := u.dec.real(tok.Data)
+			value, err := u.real(tok.Data)
 			if err != nil {
 				return err
 			}
@@ -412,18 +1592,41 @@ func (u *Unmarshaler) scalar(v reflect.Value) error {
 			}
 			v.SetFloat(value)
 		case reflect.Interface:
-			value, err := u.dec.real(tok.Data)
+			value, err := u.real(tok.Data)
 			if err != nil {
 				return err
 			}
 			v.Set(reflect.ValueOf(value))
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			// Integral reals are accepted by fields tagged numeric
+			value, err := u.real(tok.Data)
+			if err != nil {
+				return err
+			}
+			if info == nil || !info.LLSDTag.Numeric || value != math.Trunc(value) || v.OverflowInt(int64(value)) {
+				return &UnmarshalTypeError{Value: "real " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+			}
+			v.SetInt(int64(value))
 		default:
-			return &UnmarshalTypeError{Value: "real " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+			if _, ok := v.Interface().(time.Time); !ok {
+				return &UnmarshalTypeError{Value: "real " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+			}
+			// Epoch times are expected by fields tagged epoch
+			if info == nil || !info.LLSDTag.Epoch {
+				if err := u.convert(v, "real", tok); err != nil {
+					return err
+				}
+			}
+			value, err := u.real(tok.Data)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(u.DateUnit.time(value)))
 		}
 	case Integer:
 		switch v.Kind() {
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			value, err := u.dec.integer(tok.Data)
+			value, err := u.integer(tok.Data)
 			if err != nil {
 				return err
 			}
@@ -431,34 +1634,114 @@ func (u *Unmarshaler) scalar(v reflect.Value) error {
 				return &UnmarshalTypeError{Value: "integer " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
 			}
 			v.SetInt(value)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value, err := u.integer(tok.Data)
+			if err != nil {
+				return err
+			}
+			if value < 0 || v.OverflowUint(uint64(value)) {
+				return &UnmarshalTypeError{Value: "integer " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+			}
+			v.SetUint(uint64(value))
 		case reflect.Interface:
-			value, err := u.dec.integer(tok.Data)
+			value, err := u.integer(tok.Data)
 			if err != nil {
 				return err
 			}
 			v.Set(reflect.ValueOf(int32(value)))
+		case reflect.Float32, reflect.Float64:
+			// Integers are accepted by fields tagged numeric
+			if info == nil || !info.LLSDTag.Numeric {
+				return &UnmarshalTypeError{Value: "integer " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+			}
+			value, err := u.integer(tok.Data)
+			if err != nil {
+				return err
+			}
+			v.SetFloat(float64(value))
+		default:
+			if _, ok := v.Interface().(time.Time); !ok {
+				return &UnmarshalTypeError{Value: "integer " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+			}
+			if info == nil || !info.LLSDTag.Epoch {
+				if err := u.convert(v, "integer", tok); err != nil {
+					return err
+				}
+			}
+			value, err := u.integer(tok.Data)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(u.DateUnit.time(float64(value))))
+		}
+	case UUIDType:
+		value, err := u.dec.UUID(tok.Data)
+		if err != nil {
+			return err
+		}
+		switch v.Kind() {
+		case reflect.Interface:
+			v.Set(reflect.ValueOf(value))
+		case reflect.String:
+			if err := u.convert(v, "uuid", tok); err != nil {
+				return err
+			}
+			v.SetString(value.String())
 		default:
-			return &UnmarshalTypeError{Value: "integer " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+			if v.Type() != uuidType {
+				return &UnmarshalTypeError{Value: "uuid " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+			}
+			v.Set(reflect.ValueOf(value))
 		}
 	case URI:
-		v.Set(reflect.ValueOf(URL(tok.Data)))
+		if v.Type() == urlType {
+			value, err := url.Parse(string(tok.Data))
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(*value))
+			return nil
+		}
+		if u.ValidateURIs {
+			if _, err := url.Parse(string(tok.Data)); err != nil {
+				return err
+			}
+		}
+		switch v.Kind() {
+		case reflect.String:
+			v.SetString(string(tok.Data))
+		case reflect.Interface:
+			v.Set(reflect.ValueOf(URL(tok.Data)))
+		default:
+			return &UnmarshalTypeError{Value: "uri " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+		}
 	case String:
 		switch v.Kind() {
 		case reflect.String, reflect.Interface:
 			v.Set(reflect.ValueOf(string(tok.Data)))
 		default:
+			// Accept IP addresses in text form
+			if v.Type() == ipType {
+				if ip := net.ParseIP(string(tok.Data)); ip != nil {
+					v.Set(reflect.ValueOf(ip))
+					return nil
+				}
+			}
 			return &UnmarshalTypeError{Value: "string " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
 		}
 	case Boolean:
 		switch v.Kind() {
 		case reflect.Bool, reflect.Interface:
-			value, err := u.dec.boolean(tok.Data)
+			value, err := u.dec.Boolean(tok.Data)
 			if err != nil {
 				return err
 			}
 			v.Set(reflect.ValueOf(value))
 		case reflect.String:
-			value, err := u.dec.boolean(tok.Data)
+			if err := u.convert(v, "boolean", tok); err != nil {
+				return err
+			}
+			value, err := u.dec.Boolean(tok.Data)
 			if err != nil {
 				return err
 			}
@@ -467,25 +1750,40 @@ func (u *Unmarshaler) scalar(v reflect.Value) error {
 			} else {
 				v.SetString("false")
 			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			// Booleans convert to numbers as 1 and 0
+			if err := u.convert(v, "boolean", tok); err != nil {
+				return err
+			}
+			value, err := u.dec.Boolean(tok.Data)
+			if err != nil {
+				return err
+			}
+			n := 0
+			if value {
+				n = 1
+			}
+			v.Set(reflect.ValueOf(n).Convert(v.Type()))
 		default:
 			return &UnmarshalTypeError{Value: "boolean " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
 		}
 	case Binary:
-		encoding := ""
-		if u.text {
-			// Handle possible text encodings: base16, base64, base85
-			ok := false
-			encoding, ok = tok.Attr["encoding"]
-			if !ok {
-				encoding = Base16
-			}
-		}
-		value, err := u.dec.binary(tok.Data, encoding)
+		value, err := u.binary(tok, info)
 		if err != nil {
 			return err
 		}
+		if info != nil && info.LLSDTag.Packed && v.Kind() == reflect.Struct {
+			return u.packed(v, value, tok)
+		}
 		// Support some of the hare-brained conversions for binary specified at
 		// https://wiki.secondlife.com/wiki/LLSD#Conversion_6
+		if k := v.Kind(); k != reflect.Slice && k != reflect.Array && k != reflect.Interface {
+			if err := u.convert(v, "binary", tok); err != nil {
+				return err
+			}
+		}
 		switch v.Kind() {
 		case reflect.Slice, reflect.Array:
 			if v.Type().Elem().Kind() != reflect.Uint8 {
@@ -541,9 +1839,15 @@ func (u *Unmarshaler) scalar(v reflect.Value) error {
 			return &UnmarshalTypeError{Value: "binary " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
 		}
 	case Date:
+		// time.Time is a struct, anything else is a conversion
+		if k := v.Kind(); k != reflect.Struct && k != reflect.Interface {
+			if err := u.convert(v, "date", tok); err != nil {
+				return err
+			}
+		}
 		switch v.Kind() {
 		case reflect.Float32, reflect.Float64:
-			value, err := u.dec.date(tok.Data)
+			value, err := u.dec.Date(tok.Data)
 			if err != nil {
 				return err
 			}
@@ -553,7 +1857,7 @@ func (u *Unmarshaler) scalar(v reflect.Value) error {
 			}
 			v.SetFloat(epoch)
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			value, err := u.dec.date(tok.Data)
+			value, err := u.dec.Date(tok.Data)
 			if err != nil {
 				return err
 			}
@@ -565,16 +1869,24 @@ func (u *Unmarshaler) scalar(v reflect.Value) error {
 		case reflect.String:
 			v.SetString(string(tok.Data))
 		case reflect.Interface:
-			value, err := u.dec.date(tok.Data)
+			if u.DateMode == AsString {
+				v.Set(reflect.ValueOf(string(tok.Data)))
+				return nil
+			}
+			value, err := u.dec.Date(tok.Data)
 			if err != nil {
 				return err
 			}
+			if u.DateMode == AsEpoch {
+				v.Set(reflect.ValueOf(float64(value.UnixNano()) / 1e9))
+				return nil
+			}
 			v.Set(reflect.ValueOf(value))
 		default:
 			if _, ok := v.Interface().(time.Time); !ok {
 				return &UnmarshalTypeError{Value: "date " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
 			}
-			value, err := u.dec.date(tok.Data)
+			value, err := u.dec.Date(tok.Data)
 			if err != nil {
 				return err
 			}
@@ -587,6 +1899,112 @@ func (u *Unmarshaler) scalar(v reflect.Value) error {
 	return nil
 }
 
+// packed unpacks binary data into a struct of fixed-size fields, as
+// encoding/binary reads it in big-endian byte order.
+func (u *Unmarshaler) packed(v reflect.Value, value []byte, tok Scalar) error {
+	size := binary.Size(v.Interface())
+	if size < 0 || !packedSettable(v.Type()) {
+		return &UnmarshalTypeError{Value: "binary", Type: v.Type(), Offset: u.scan.Offset(), Field: strings.Join(u.path, ".")}
+	}
+	if len(value) != size {
+		return &UnmarshalTypeError{Value: fmt.Sprintf("binary of %d bytes", len(value)), Type: v.Type(), Offset: u.scan.Offset(), Field: strings.Join(u.path, ".")}
+	}
+	dst := reflect.New(v.Type())
+	if err := binary.Read(bytes.NewReader(value), binary.BigEndian, dst.Interface()); err != nil {
+		return err
+	}
+	v.Set(dst.Elem())
+	return nil
+}
+
+// packedSettable reports whether binary.Read can set every field of t.
+// Unexported fields other than blank (_) padding cannot be set.
+func packedSettable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Array:
+		return packedSettable(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Name == "_" {
+				continue
+			}
+			if !f.IsExported() || !packedSettable(f.Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// convert checks whether a scalar may be converted into a value of another
+// LLSD type, which StrictTypes disallows.
+func (u *Unmarshaler) convert(v reflect.Value, name string, tok Scalar) error {
+	if u.StrictTypes {
+		return &UnmarshalTypeError{Value: name + " " + string(tok.Data), Type: v.Type(), Offset: u.scan.Offset()}
+	}
+	return nil
+}
+
+// real decodes the data of a real scalar.
+func (u *Unmarshaler) real(data []byte) (float64, error) {
+	if u.text && u.AcceptCommaDecimal && bytes.Count(data, []byte(",")) == 1 && !bytes.Contains(data, []byte(".")) {
+		data = bytes.Replace(data, []byte(","), []byte("."), 1)
+	}
+	return u.dec.Real(data)
+}
+
+// integer decodes the data of an integer scalar. LLSD integers are decimal,
+// but unless StrictTypes is set, text integers with a zero fractional part
+// such as 42.0 or a hexadecimal 0x prefix such as 0x1F are accepted.
+// Hexadecimal integers are parsed here rather than by the ScalarDecoder.
+func (u *Unmarshaler) integer(data []byte) (int64, error) {
+	if !u.text {
+		return u.dec.Integer(data)
+	}
+	digits := bytes.TrimLeft(data, "+-")
+	hex := bytes.HasPrefix(digits, []byte("0x")) || bytes.HasPrefix(digits, []byte("0X"))
+	if u.StrictTypes {
+		if hex {
+			return 0, fmt.Errorf("Integer \"%s\" is not decimal", data)
+		}
+		return u.dec.Integer(data)
+	}
+	if hex {
+		n, err := strconv.ParseInt(string(data[:len(data)-len(digits)])+string(digits[2:]), 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid hexadecimal integer \"%s\"", data)
+		}
+		return n, nil
+	}
+	if i := bytes.IndexByte(data, '.'); i > 0 && len(bytes.Trim(data[i+1:], "0")) == 0 {
+		data = data[:i]
+	}
+	return u.dec.Integer(data)
+}
+
+// binary decodes the data of a binary scalar.
+func (u *Unmarshaler) binary(tok Scalar, info *fieldInfo) ([]byte, error) {
+	encoding := ""
+	if u.text {
+		// Handle possible text encodings: base16, base64, base85. Without an
+		// encoding attribute, use the encoding given by the field tag if any.
+		ok := false
+		encoding, ok = tok.Attr["encoding"]
+		if !ok {
+			encoding = Base16
+			if info != nil && info.LLSDTag.Encoding != "" {
+				encoding = info.LLSDTag.Encoding
+			}
+		}
+	}
+	value, err := u.dec.Binary(tok.Data, encoding)
+	if err != nil || info == nil || info.LLSDTag.Codec == "" {
+		return value, err
+	}
+	return decodeWith(info.LLSDTag.Codec, value)
+}
+
 // UnmarshalXML attempts to deserialize given LLSD XML data into a given value.
 func UnmarshalXML(data []byte, v any) error {
 	return NewXMLDecoder(bytes.NewReader(data)).Unmarshal(v)
@@ -599,10 +2017,29 @@ func UnmarshalBinary(data []byte, v any) error {
 
 // NewXMLDecoder creates a new instance of an Unmarshaler configured to read LLSD XML.
 func NewXMLDecoder(r io.Reader) *Unmarshaler {
-	return &Unmarshaler{scan: NewXMLScanner(r), tok: nil, dec: &textDecoder{}, text: true}
+	return NewXMLDecoderWith(r, DecoderOptions{})
+}
+
+// NewXMLDecoderWith creates an Unmarshaler reading LLSD XML configured with the given options.
+func NewXMLDecoderWith(r io.Reader, opts DecoderOptions) *Unmarshaler {
+	return &Unmarshaler{DecoderOptions: opts, scan: NewXMLScanner(r), tok: nil, dec: &textDecoder{}, text: true}
+}
+
+// NewDecoder creates an Unmarshaler reading tokens from r, such as a wrapped
+// scanner, whose scalar data is in the given format.
+func NewDecoder(r TokenReader, format Format, opts DecoderOptions) *Unmarshaler {
+	if format == FormatBinary {
+		return &Unmarshaler{DecoderOptions: opts, scan: r, dec: &binaryDecoder{}, text: false}
+	}
+	return &Unmarshaler{DecoderOptions: opts, scan: r, dec: &textDecoder{}, text: true}
 }
 
 // NewBinaryDecoder creates a new instance of an Unmarshaler configured to read binary LLSD.
 func NewBinaryDecoder(r io.Reader) *Unmarshaler {
-	return &Unmarshaler{scan: NewBinaryScanner(r), tok: nil, dec: &binaryDecoder{}, text: false}
+	return NewBinaryDecoderWith(r, DecoderOptions{})
+}
+
+// NewBinaryDecoderWith creates an Unmarshaler reading binary LLSD configured with the given options.
+func NewBinaryDecoderWith(r io.Reader, opts DecoderOptions) *Unmarshaler {
+	return &Unmarshaler{DecoderOptions: opts, scan: NewBinaryScanner(r), tok: nil, dec: &binaryDecoder{}, text: false}
 }
@@ -3,26 +3,137 @@ package llsd
 import (
 	"bufio"
 	"bytes"
+	"encoding"
 	"encoding/ascii85"
 	"encoding/base64"
-	"encoding/hex"
+	"encoding/binary"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// NilSlicePolicy controls how nil slices are encoded, letting APIs
+// distinguish an absent list from an empty one.
+type NilSlicePolicy int
+
+const (
+	NilSliceEmpty NilSlicePolicy = iota // written like an empty slice
+	NilSliceOmit                        // omitted from maps and structs, otherwise written like an empty slice
+	NilSliceUndef                       // written as undef
+)
+
+// EncoderOptions configures an XMLEncoder.
+type EncoderOptions struct {
+	Indent          string                // Indentation of nested elements, "" for compact output
+	SortKeys        bool                  // Write map and struct keys in sorted order
+	LiteralBooleans bool                  // Write booleans as true/false rather than 1/0
+	BinaryEncoding  string                // Default binary encoding: base16, base64, base85
+	Fragment        bool                  // Omit the XML declaration and <llsd> root element
+	KeyFilter       func(key string) bool // Skip keys for which KeyFilter returns false
+	InjectFields    map[string]any        // Extra keys merged into the root map
+	ZeroTimeAsUndef bool                  // Write the zero time.Time as undef rather than a date
+	DurationNanos   bool                  // Write time.Duration as integer nanoseconds rather than real seconds
+	TightEmpty      bool                  // Write empty elements as <undef/> rather than <undef />
+	NilSlices       NilSlicePolicy        // Handling of nil slices
+	MaxOutputBytes  int64                 // Abort encoding once output exceeds this size, 0 for no limit
+	// FieldName, if set, names struct fields without a name given by their
+	// tag, such as SnakeCase. It must depend only on the field name.
+	FieldName func(name string) string
+}
+
+// ErrOutputLimit is returned by Encode when output exceeds MaxOutputBytes.
+// The encoder may be used again for the next value.
+var ErrOutputLimit = errors.New("LLSD: output exceeds MaxOutputBytes")
+
+// ErrCycle is returned by Encode when a value contains itself, such as a map
+// holding itself through an interface.
+var ErrCycle = errors.New("LLSD: cycle detected")
+
+// startDetectingCyclesAfter is the nesting of pointers, maps and slices after
+// which the encoder tracks values being written to detect cycles, keeping
+// shallow values fast.
+const startDetectingCyclesAfter = 1000
+
+// ErrEncoderClosed is returned by Encode after the encoder has been closed.
+var ErrEncoderClosed = errors.New("LLSD: encoder is closed")
+
+// limitWriter counts bytes written to w and fails writes past max.
+type limitWriter struct {
+	w   io.Writer
+	n   int64
+	max int64
+	err error
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if l.max > 0 && l.n+int64(len(p)) > l.max {
+		l.err = ErrOutputLimit
+		return 0, l.err
+	}
+	n, err := l.w.Write(p)
+	l.n += int64(n)
+	return n, err
+}
+
 type XMLEncoder struct {
 	w      *bufio.Writer
-	indent string
+	out    *limitWriter
+	opts   EncoderOptions
 	depth  int
+	root   int  // depth of the root value
+	closed bool // Close has been called
+
+	ptrLevel int                 // nesting of pointers, maps and slices being written
+	ptrSeen  map[ptrKey]struct{} // pointers, maps and slices being written, once deeply nested
+
+	named namedFieldCache // fields named by FieldName
 }
 
+// ptrKey identifies a pointer, map or slice being written. Slices sharing an
+// array are distinguished by length.
+type ptrKey struct {
+	ptr uintptr
+	len int
+}
+
+var (
+	textMarshalerType         = reflect.TypeOf((*TextMarshaler)(nil)).Elem()
+	llsdMarshalerType         = reflect.TypeOf((*LLSDMarshaler)(nil)).Elem()
+	encodingTextMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringerType              = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	lazyType                  = reflect.TypeOf(Lazy(nil))
+	jsonRawMessageType        = reflect.TypeOf(json.RawMessage(nil))
+	rawMessageType            = reflect.TypeOf(RawMessage(nil))
+	timeType                  = reflect.TypeOf(time.Time{})
+	durationType              = reflect.TypeOf(time.Duration(0))
+	ipType                    = reflect.TypeOf(net.IP(nil))
+	urlType                   = reflect.TypeOf(url.URL{})
+	uuidType                  = reflect.TypeOf(UUID{})
+	isZeroerType              = reflect.TypeOf((*isZeroer)(nil)).Elem()
+)
+
+// isZeroer is implemented by types which define their own zero value for
+// omitempty, such as time.Time and UUID.
+type isZeroer interface {
+	IsZero() bool
+}
+
+// Lazy is a value computed by the encoder only when it is written, such as
+// when its key passes the encoder's key filter.
+type Lazy func() any
+
 func MarshalXML(v any) ([]byte, error) {
 	var b bytes.Buffer
 	if err := NewXMLEncoder(&b).Encode(v); err != nil {
@@ -31,6 +142,26 @@ func MarshalXML(v any) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// AppendXML appends the LLSD XML encoding of v to dst, returning the extended
+// buffer, so that callers may reuse a scratch buffer across calls.
+func AppendXML(dst []byte, v any) ([]byte, error) {
+	w := appendWriter{buf: dst}
+	if err := NewXMLEncoder(&w).Encode(v); err != nil {
+		return dst, err
+	}
+	return w.buf, nil
+}
+
+// appendWriter appends written bytes to buf.
+type appendWriter struct {
+	buf []byte
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
 func MarshalXMLIndent(v any, indent string) ([]byte, error) {
 	var b bytes.Buffer
 	enc := NewXMLEncoder(&b)
@@ -41,33 +172,82 @@ func MarshalXMLIndent(v any, indent string) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// CanonicalXML returns a deterministic encoding of v suitable for signing.
+// Keys of maps, structs, pairs and extras are sorted, reals use their
+// shortest round-trip form, there is no indentation, booleans are written as
+// 1/0 and binary as base64. Output depends only on v, not on map iteration
+// order.
+func CanonicalXML(v any) ([]byte, error) {
+	var b bytes.Buffer
+	enc := NewXMLEncoderWith(&b, EncoderOptions{SortKeys: true, BinaryEncoding: Base64})
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
 func NewXMLEncoder(w io.Writer) *XMLEncoder {
-	return &XMLEncoder{w: bufio.NewWriter(w)}
+	return NewXMLEncoderWith(w, EncoderOptions{})
+}
+
+// NewXMLEncoderWith creates an XMLEncoder configured with the given options.
+func NewXMLEncoderWith(w io.Writer, opts EncoderOptions) *XMLEncoder {
+	out := &limitWriter{w: w}
+	return &XMLEncoder{w: bufio.NewWriter(out), out: out, opts: opts}
 }
 
 func (e *XMLEncoder) writeIndent() {
-	if e.indent == "" {
+	if e.opts.Indent == "" {
 		return
 	}
-	e.writeString("\n" + strings.Repeat(e.indent, e.depth))
+	e.writeString("\n" + strings.Repeat(e.opts.Indent, e.depth))
 }
 
+// Encode writes v as a complete LLSD document, including the XML declaration
+// and <llsd> root element unless writing fragments. Encode is single-shot:
+// call it once per encoder, then Close. Encoding another value writes a
+// second root element, which is not a valid document, unless the previous
+// Encode failed.
 func (e *XMLEncoder) Encode(v any) error {
-	e.writeString(xml.Header)
-	e.writeString("<llsd>")
-	e.depth++
+	if e.closed {
+		return ErrEncoderClosed
+	}
+
+	// Each value is limited separately. A value which exceeded the limit
+	// leaves no state behind: its buffered output is discarded.
+	if e.out.err != nil {
+		e.out.err = nil
+		e.w.Reset(e.out)
+		e.depth = 0
+	}
+	e.out.n = 0
+	e.out.max = e.opts.MaxOutputBytes
+	e.named = nil
+
+	if !e.opts.Fragment {
+		e.writeString(xml.Header)
+		e.writeString("<llsd>")
+		e.depth++
+	}
+	e.root = e.depth
 	err := e.marshalValue(reflect.ValueOf(v), nil)
 	if err != nil {
 		return err
 	}
-	e.depth--
-	e.writeIndent()
-	e.writeString("</llsd>")
+	if !e.opts.Fragment {
+		e.depth--
+		e.writeIndent()
+		e.writeString("</llsd>")
+	}
 	e.Flush()
-	return nil
+	return e.out.err
 }
 
 func (c *XMLEncoder) marshalValue(v reflect.Value, info *fieldInfo) error {
+	// Stop once output has exceeded its limit
+	if c.out.err != nil {
+		return c.out.err
+	}
 
 	// Skip unexported fields
 	if !v.CanInterface() {
@@ -82,10 +262,14 @@ func (c *XMLEncoder) marshalValue(v reflect.Value, info *fieldInfo) error {
 		return nil
 	}
 
+	// Use custom marshaler of the whole value
+	if v.Type().Implements(llsdMarshalerType) {
+		return v.Interface().(LLSDMarshaler).MarshalLLSD(c)
+	}
+
 	// Use custom marshaler
-	m, ok := v.Interface().(TextMarshaler)
-	if ok {
-		ty, val, err := m.MarshalTextLLSD()
+	if v.Type().Implements(textMarshalerType) {
+		ty, val, err := v.Interface().(TextMarshaler).MarshalTextLLSD()
 		if err != nil {
 			return err
 		}
@@ -94,27 +278,195 @@ func (c *XMLEncoder) marshalValue(v reflect.Value, info *fieldInfo) error {
 		return nil
 	}
 
+	// Evaluate lazy values at emission time
+	if v.Type() == lazyType {
+		lazy := v.Interface().(Lazy)
+		if lazy == nil {
+			c.writeIndent()
+			c.writeEmpty("undef")
+			return nil
+		}
+		value := lazy()
+		return c.marshalValue(reflect.ValueOf(&value).Elem(), info)
+	}
+
+	// Write raw LLSD verbatim, or undef when empty
+	if v.Type() == rawMessageType {
+		c.writeIndent()
+		if v.Len() == 0 {
+			c.writeEmpty("undef")
+			return nil
+		}
+		_, _ = c.w.Write(v.Bytes())
+		return nil
+	}
+
+	// Walk JSON documents, emitting them as nested LLSD, or undef when empty
+	if v.Type() == jsonRawMessageType {
+		if v.Len() == 0 {
+			c.writeIndent()
+			c.writeEmpty("undef")
+			return nil
+		}
+		return c.marshalJSON(v.Interface().(json.RawMessage))
+	}
+
+	// Guard against values containing themselves
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		c.ptrLevel++
+		defer func() { c.ptrLevel-- }()
+		if c.ptrLevel > startDetectingCyclesAfter && !v.IsNil() {
+			key := ptrKey{ptr: v.Pointer()}
+			if v.Kind() == reflect.Slice {
+				key.len = v.Len()
+			}
+			if _, ok := c.ptrSeen[key]; ok {
+				return fmt.Errorf("%w at value of type %s", ErrCycle, v.Type())
+			}
+			if c.ptrSeen == nil {
+				c.ptrSeen = make(map[ptrKey]struct{})
+			}
+			c.ptrSeen[key] = struct{}{}
+			defer delete(c.ptrSeen, key)
+		}
+	}
+
 	if v.Kind() == reflect.Pointer {
 		// Write null pointer as Undef
 		if v.IsNil() {
 			c.writeIndent()
-			c.writeString("<undef />")
+			c.writeEmpty("undef")
 			return nil
 		}
 		// If not a null pointer then get the actual value
 		v = v.Elem()
 	}
 
+	// Encode arbitrary precision numbers
+	if ok, err := c.marshalBig(v); ok {
+		return err
+	}
+
+	// Fall back to the text form of types unknown to LLSD, such as decimals
+	if ok, err := c.marshalText(v, info); ok {
+		return err
+	}
+
+	// Transform values of fields with an encode codec
+	if info != nil && info.LLSDTag.Encoder != "" {
+		var err error
+		if v, err = encodeCodec(info.LLSDTag.Encoder, v); err != nil {
+			return err
+		}
+	}
+
+	// Durations are int64 so must be handled before the kind switch
+	if v.Type() == durationType {
+		c.writeIndent()
+		if c.opts.DurationNanos {
+			c.writeString("<integer>")
+			c.writeString(strconv.FormatInt(v.Int(), 10))
+			c.writeString("</integer>")
+			return nil
+		}
+		c.writeString("<real>")
+		c.writeString(strconv.FormatFloat(time.Duration(v.Int()).Seconds(), 'g', -1, 64))
+		c.writeString("</real>")
+		return nil
+	}
+
+	// Dates are structs so must be handled before the kind switch
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		c.writeIndent()
+		if t.IsZero() && c.opts.ZeroTimeAsUndef {
+			c.writeEmpty("undef")
+			return nil
+		}
+		if info != nil && info.LLSDTag.Epoch {
+			c.writeString("<real>")
+			c.writeString(strconv.FormatFloat(float64(t.Unix())+float64(t.Nanosecond())/1e9, 'f', -1, 64))
+			c.writeString("</real>")
+			return nil
+		}
+		c.writeString("<date>")
+		c.writeString(t.UTC().Format(time.RFC3339Nano))
+		c.writeString("</date>")
+		return nil
+	}
+
+	if v.Type() == uuidType {
+		c.writeIndent()
+		c.writeString("<uuid>")
+		c.writeString(v.Interface().(UUID).String())
+		c.writeString("</uuid>")
+		return nil
+	}
+
+	// URLs are structs so must be handled before the kind switch
+	if v.Type() == urlType {
+		u := v.Interface().(url.URL)
+		c.writeIndent()
+		c.writeString("<uri>")
+		if err := xml.EscapeText(c.w, []byte(escapeURI(u.String()))); err != nil {
+			return err
+		}
+		c.writeString("</uri>")
+		return nil
+	}
+
+	// Injected fields are only merged into the outermost map
+	root := c.depth == c.root
+
 	switch v.Kind() {
 	case reflect.Interface:
+		// Write nil interface as Undef
+		if v.IsNil() {
+			c.writeIndent()
+			c.writeEmpty("undef")
+			return nil
+		}
 		return c.marshalValue(v.Elem(), nil)
 	case reflect.Struct:
+		if info != nil && info.LLSDTag.Packed {
+			var b bytes.Buffer
+			if err := binary.Write(&b, binary.BigEndian, v.Interface()); err != nil {
+				return err
+			}
+			return c.marshalBinary(b.Bytes(), info)
+		}
+		if isTupleStruct(v.Type()) {
+			return c.marshalTuple(v)
+		}
 		c.writeIndent()
 		c.writeString("<map>")
 		c.depth++
-		fields := cachedFieldsForType(v.Type())
-		for key, field := range fields {
-			if field.LLSDTag.Omit {
+		if root {
+			if err := c.marshalInjected(); err != nil {
+				return err
+			}
+		}
+		fields := c.named.fieldsForType(v.Type(), c.opts.FieldName)
+		extras, err := extrasMap(v, fields)
+		if err != nil {
+			return err
+		}
+		for _, key := range c.fieldKeys(fields, extras) {
+			field, ok := fields[key]
+			if !ok {
+				if err := c.marshalExtra(extras, key, root); err != nil {
+					return err
+				}
+				continue
+			}
+			if field.LLSDTag.Omit || field.LLSDTag.Attrs || field.LLSDTag.Fallback || field.LLSDTag.Rest || field.LLSDTag.Extras {
+				continue
+			}
+			if root && c.isInjected(key) {
+				continue
+			}
+			if c.opts.KeyFilter != nil && !c.opts.KeyFilter(key) {
 				continue
 			}
 			subv := v.FieldByIndex(field.Index)
@@ -125,6 +477,9 @@ func (c *XMLEncoder) marshalValue(v reflect.Value, info *fieldInfo) error {
 			if field.LLSDTag.OmitEmpty && isEmptyValue(subv) {
 				continue
 			}
+			if c.omitNil(subv) {
+				continue
+			}
 			c.writeIndent()
 			c.writeString("<key>")
 			c.writeString(key)
@@ -137,16 +492,34 @@ func (c *XMLEncoder) marshalValue(v reflect.Value, info *fieldInfo) error {
 		c.writeIndent()
 		c.writeString("</map>")
 	case reflect.Map:
+		if info != nil && info.LLSDTag.Pairs {
+			return c.marshalPairs(v)
+		}
 		c.writeIndent()
 		c.writeString("<map>")
 		c.depth++
-		for _, key := range v.MapKeys() {
-			c.writeIndent()
+		if root {
+			if err := c.marshalInjected(); err != nil {
+				return err
+			}
+		}
+		keys := v.MapKeys()
+		if c.opts.SortKeys {
+			sortMapKeys(keys)
+		}
+		for _, key := range keys {
+			if root && c.isInjected(key.String()) {
+				continue
+			}
+			if c.opts.KeyFilter != nil && !c.opts.KeyFilter(key.String()) {
+				continue
+			}
 			subv := v.MapIndex(key)
 			// Skip unexported fields
-			if !subv.CanInterface() {
+			if !subv.CanInterface() || c.omitNil(subv) {
 				continue
 			}
+			c.writeIndent()
 			c.writeString("<key>")
 			// TODO: Make key marshaling more flexible
 			if err := xml.EscapeText(c.w, []byte(key.String())); err != nil {
@@ -157,32 +530,25 @@ func (c *XMLEncoder) marshalValue(v reflect.Value, info *fieldInfo) error {
 				return err
 			}
 		}
+		c.depth--
 		c.writeIndent()
 		c.writeString("</map>")
-		c.depth--
 	case reflect.Array, reflect.Slice:
-		// There has to be a better way of getting reflect.Type of byte
-		if v.Type().Elem().Kind() == reflect.Uint8 {
+		if c.opts.NilSlices == NilSliceUndef && v.Kind() == reflect.Slice && v.IsNil() {
 			c.writeIndent()
-			encoding := Base16
-			if info != nil && info.LLSDTag.Encoding != "" {
-				encoding = info.LLSDTag.Encoding
-			}
-			if encoding == Base16 {
-				c.writeString("<binary>")
-			} else {
-				c.writeString(fmt.Sprintf("<binary encoding=\"%s\">", encoding))
-			}
-			slice, ok := v.Slice(0, v.Len()).Interface().([]byte)
-			if !ok {
-				return errors.New("Unable to cast binary slice")
-			}
-			if err := c.writeBytes(slice, encoding); err != nil {
-				return err
-			}
-			c.writeString("</binary>")
+			c.writeEmpty("undef")
 			return nil
 		}
+		// There has to be a better way of getting reflect.Type of byte
+		if v.Type().Elem().Kind() == reflect.Uint8 && (info == nil || !info.LLSDTag.IntArray) {
+			if v.Kind() == reflect.Array && !v.CanAddr() {
+				// Copy arrays held in interfaces so that they can be sliced
+				addr := reflect.New(v.Type()).Elem()
+				addr.Set(v)
+				v = addr
+			}
+			return c.marshalBinary(v.Slice(0, v.Len()).Bytes(), info)
+		}
 		c.writeIndent()
 		c.writeString("<array>")
 		c.depth++
@@ -192,13 +558,14 @@ func (c *XMLEncoder) marshalValue(v reflect.Value, info *fieldInfo) error {
 				return err
 			}
 		}
-		c.writeString("</array>")
 		c.depth--
+		c.writeIndent()
+		c.writeString("</array>")
 	case reflect.String:
 		if _, ok := v.Interface().(URL); ok {
 			c.writeIndent()
 			c.writeString("<uri>")
-			if err := xml.EscapeText(c.w, []byte(v.String())); err != nil {
+			if err := xml.EscapeText(c.w, []byte(escapeURI(v.String()))); err != nil {
 				return err
 			}
 			c.writeString("</uri>")
@@ -223,44 +590,31 @@ func (c *XMLEncoder) marshalValue(v reflect.Value, info *fieldInfo) error {
 	case reflect.Float32, reflect.Float64:
 		c.writeIndent()
 		c.writeString("<real>")
-		c.writeString(fmt.Sprintf("%f", v.Float()))
+		c.writeString(strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()))
 		c.writeString("</real>")
 	case reflect.Bool:
 		c.writeIndent()
 		c.writeString("<boolean>")
-		if v.Bool() {
+		switch {
+		case c.opts.LiteralBooleans && v.Bool():
+			c.writeString("true")
+		case c.opts.LiteralBooleans:
+			c.writeString("false")
+		case v.Bool():
 			c.writeString("1")
-		} else {
+		default:
 			c.writeString("0")
 		}
 		c.writeString("</boolean>")
 	default:
-		vi := v.Interface()
-		switch vi := vi.(type) {
-		case UUID:
-			c.writeIndent()
-			c.writeString("<uuid>")
-			c.writeString(vi.String())
-			c.writeString("</uuid>")
+		switch v.Interface().(type) {
 		case URL:
 			c.writeIndent()
 			c.writeString("<uri>")
-			if err := xml.EscapeText(c.w, []byte(v.String())); err != nil {
+			if err := xml.EscapeText(c.w, []byte(escapeURI(v.String()))); err != nil {
 				return err
 			}
 			c.writeString("</uri>")
-		case url.URL:
-			c.writeIndent()
-			c.writeString("<uri>")
-			if err := xml.EscapeText(c.w, []byte(vi.String())); err != nil {
-				return err
-			}
-			c.writeString("</uri>")
-		case time.Time:
-			c.writeIndent()
-			c.writeString("<date>")
-			c.writeString(vi.Format(time.RFC3339))
-			c.writeString("</date>")
 		default:
 			return &MarshalTypeError{Type: v.Type()}
 		}
@@ -268,21 +622,424 @@ func (c *XMLEncoder) marshalValue(v reflect.Value, info *fieldInfo) error {
 	return nil
 }
 
+// fieldKeys returns the keys of struct fields and the keys of extras not
+// shadowed by a field, sorted together if requested.
+func (e *XMLEncoder) fieldKeys(fields fieldInfoMap, extras reflect.Value) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	if extras.IsValid() {
+		for _, key := range extras.MapKeys() {
+			if _, ok := fields[key.String()]; !ok {
+				keys = append(keys, key.String())
+			}
+		}
+	}
+	if e.opts.SortKeys {
+		sort.Strings(keys)
+	}
+	return keys
+}
+
+// escapeURI percent-encodes the bytes of s which may not appear in a URI per
+// RFC 3986, such as spaces and non-ASCII characters. Reserved characters and
+// existing escapes are left unchanged.
+func escapeURI(s string) string {
+	const hex = "0123456789ABCDEF"
+	i := 0
+	for i < len(s) && isURIChar(s[i]) {
+		i++
+	}
+	if i == len(s) {
+		return s
+	}
+	var b strings.Builder
+	b.WriteString(s[:i])
+	for ; i < len(s); i++ {
+		if c := s[i]; isURIChar(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+		}
+	}
+	return b.String()
+}
+
+// isURIChar reports whether c may appear unescaped in a URI.
+func isURIChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("-._~:/?#[]@!$&'()*+,;=%", c) >= 0
+}
+
+// sortMapKeys sorts map keys in increasing order. Numeric keys are ordered by
+// value and others by their string form.
+func sortMapKeys(keys []reflect.Value) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.String:
+			return a.String() < b.String()
+		}
+		return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+	})
+}
+
+// extrasMap returns the map of struct v tagged `llsd:",extras"`, if any,
+// whose entries are written as keys of the struct. Keys of the struct's own
+// fields take precedence.
+func extrasMap(v reflect.Value, fields fieldInfoMap) (reflect.Value, error) {
+	field, ok := fields[extrasKey]
+	if !ok {
+		return reflect.Value{}, nil
+	}
+	extras := v.FieldByIndex(field.Index)
+	if !extras.CanInterface() {
+		return reflect.Value{}, nil
+	}
+	if extras.Kind() != reflect.Map || extras.Type().Key().Kind() != reflect.String {
+		return reflect.Value{}, &MarshalTypeError{Type: extras.Type()}
+	}
+	return extras, nil
+}
+
+// marshalExtra writes the entry of an extras map with the given key.
+func (e *XMLEncoder) marshalExtra(extras reflect.Value, name string, root bool) error {
+	if root && e.isInjected(name) {
+		return nil
+	}
+	if e.opts.KeyFilter != nil && !e.opts.KeyFilter(name) {
+		return nil
+	}
+	e.writeIndent()
+	e.writeString("<key>")
+	if err := xml.EscapeText(e.w, []byte(name)); err != nil {
+		return err
+	}
+	e.writeString("</key>")
+	key := reflect.ValueOf(name).Convert(extras.Type().Key())
+	return e.marshalValue(extras.MapIndex(key), nil)
+}
+
+// marshalPairs writes a map as an array of two-element key/value arrays.
+func (e *XMLEncoder) marshalPairs(v reflect.Value) error {
+	e.writeIndent()
+	e.writeString("<array>")
+	e.depth++
+	keys := v.MapKeys()
+	if e.opts.SortKeys {
+		sortMapKeys(keys)
+	}
+	for _, key := range keys {
+		e.writeIndent()
+		e.writeString("<array>")
+		e.depth++
+		if err := e.marshalValue(key, nil); err != nil {
+			return err
+		}
+		if err := e.marshalValue(v.MapIndex(key), nil); err != nil {
+			return err
+		}
+		e.depth--
+		e.writeIndent()
+		e.writeString("</array>")
+	}
+	e.depth--
+	e.writeIndent()
+	e.writeString("</array>")
+	return nil
+}
+
+// marshalBinary writes b as binary in the encoding of the field, or the
+// encoder's default.
+func (e *XMLEncoder) marshalBinary(b []byte, info *fieldInfo) error {
+	e.writeIndent()
+	if len(b) == 0 {
+		e.writeEmpty("binary")
+		return nil
+	}
+	encoding := Base16
+	if e.opts.BinaryEncoding != "" {
+		encoding = e.opts.BinaryEncoding
+	}
+	if info != nil && info.LLSDTag.Encoding != "" {
+		encoding = info.LLSDTag.Encoding
+	}
+	if encoding == Base16 {
+		e.writeString("<binary>")
+	} else {
+		e.writeString(fmt.Sprintf("<binary encoding=\"%s\">", encoding))
+	}
+	if err := e.writeBytes(b, encoding); err != nil {
+		return err
+	}
+	e.writeString("</binary>")
+	return nil
+}
+
+// marshalTuple writes a struct with index tagged fields as an array of its
+// fields by position, followed by the elements of its rest field, if any.
+// Positions without a field are written as undef.
+func (e *XMLEncoder) marshalTuple(v reflect.Value) error {
+	fields, err := cachedTupleFieldsForType(v.Type())
+	if err != nil {
+		return err
+	}
+	e.writeIndent()
+	e.writeString("<array>")
+	e.depth++
+	for i := range fields {
+		if fields[i].Type == nil {
+			e.writeIndent()
+			e.writeEmpty("undef")
+			continue
+		}
+		if err := e.marshalValue(v.FieldByIndex(fields[i].Index), &fields[i]); err != nil {
+			return err
+		}
+	}
+	if rest, ok := cachedFieldsForType(v.Type())[restKey]; ok {
+		restv := v.FieldByIndex(rest.Index)
+		if restv.Kind() == reflect.Slice {
+			for i := 0; i < restv.Len(); i++ {
+				if err := e.marshalValue(restv.Index(i), nil); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	e.depth--
+	e.writeIndent()
+	e.writeString("</array>")
+	return nil
+}
+
+// marshalText writes values implementing encoding.TextMarshaler as string,
+// or as real when tagged `llsd:",real"`. Values implementing fmt.Stringer are
+// only written as real when tagged. It reports whether v was written.
+func (e *XMLEncoder) marshalText(v reflect.Value, info *fieldInfo) (bool, error) {
+	real := info != nil && info.LLSDTag.Real
+	// IP addresses are written as binary rather than their text form
+	if v.Type() == timeType || v.Type() == ipType || !(v.Type().Implements(encodingTextMarshalerType) || real && v.Type().Implements(stringerType)) {
+		return false, nil
+	}
+	var text string
+	switch m := v.Interface().(type) {
+	case encoding.TextMarshaler:
+		b, err := m.MarshalText()
+		if err != nil {
+			return true, err
+		}
+		text = string(b)
+	case fmt.Stringer:
+		if !real {
+			return false, nil
+		}
+		text = m.String()
+	default:
+		return false, nil
+	}
+	e.writeIndent()
+	if real {
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return true, err
+		}
+		e.writeString("<real>")
+		e.writeString(text)
+		e.writeString("</real>")
+		return true, nil
+	}
+	e.writeString("<string>")
+	if err := xml.EscapeText(e.w, []byte(text)); err != nil {
+		return true, err
+	}
+	e.writeString("</string>")
+	return true, nil
+}
+
+// marshalJSON parses a JSON document and writes the corresponding LLSD value.
+func (e *XMLEncoder) marshalJSON(raw json.RawMessage) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	v = fromJSON(v)
+	return e.marshalValue(reflect.ValueOf(&v).Elem(), nil)
+}
+
+// fromJSON converts a decoded JSON value to its closest LLSD equivalent.
+// JSON numbers become integers when they fit in 32 bits, reals otherwise.
+func fromJSON(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 32); err == nil {
+			return int32(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, val := range v {
+			v[key] = fromJSON(val)
+		}
+		return v
+	case []any:
+		for i, val := range v {
+			v[i] = fromJSON(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// marshalInjected writes the injected fields as map entries, sorted by key.
+func (e *XMLEncoder) marshalInjected() error {
+	keys := make([]string, 0, len(e.opts.InjectFields))
+	for key := range e.opts.InjectFields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e.writeIndent()
+		e.writeString("<key>")
+		if err := xml.EscapeText(e.w, []byte(key)); err != nil {
+			return err
+		}
+		e.writeString("</key>")
+		if err := e.marshalValue(reflect.ValueOf(e.opts.InjectFields[key]), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isInjected reports whether key is overridden by an injected field.
+func (e *XMLEncoder) isInjected(key string) bool {
+	_, ok := e.opts.InjectFields[key]
+	return ok
+}
+
 func (e *XMLEncoder) writeBytes(b []byte, encoding string) error {
+	// Encoders stream into the output rather than building the encoded
+	// string, which for large blobs would double memory use
+	var enc io.WriteCloser
 	switch encoding {
 	case Base16:
-		// write upper case as the llbase python module expects it
-		e.writeString(strings.ToUpper(hex.EncodeToString(b)))
+		e.writeHex(b)
+		return nil
 	case Base64:
-		e.writeString(base64.StdEncoding.EncodeToString(b))
+		enc = base64.NewEncoder(base64.StdEncoding, e.w)
+	case Base64URL:
+		enc = base64.NewEncoder(base64.URLEncoding, e.w)
 	case Base85:
-		dst := make([]byte, ascii85.MaxEncodedLen(len(b)))
-		ascii85.Encode(dst, b)
-		if err := xml.EscapeText(e.w, dst); err != nil {
+		// base85 output includes characters which must be escaped in XML
+		enc = ascii85.NewEncoder(escapeWriter{e.w})
+	default:
+		return errors.New("Unknown encoding " + encoding)
+	}
+	if _, err := enc.Write(b); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// writeHex writes b as upper case base16, as the llbase python module
+// expects it, in chunks.
+func (e *XMLEncoder) writeHex(b []byte) {
+	const digits = "0123456789ABCDEF"
+	var buf [512]byte
+	for len(b) > 0 {
+		n := len(b)
+		if n > len(buf)/2 {
+			n = len(buf) / 2
+		}
+		for i, c := range b[:n] {
+			buf[i*2] = digits[c>>4]
+			buf[i*2+1] = digits[c&0x0f]
+		}
+		_, _ = e.w.Write(buf[:n*2])
+		b = b[n:]
+	}
+}
+
+// escapeWriter escapes text written to w for use in XML character data.
+type escapeWriter struct {
+	w io.Writer
+}
+
+func (w escapeWriter) Write(p []byte) (int, error) {
+	if err := xml.EscapeText(w.w, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteToken writes a single token, as used by LLSDMarshaler. Scalar data is
+// written as text along with any attributes, such as a binary encoding.
+func (e *XMLEncoder) WriteToken(tok Token) error {
+	switch tok := tok.(type) {
+	case MapStart:
+		e.writeIndent()
+		e.writeString("<map>")
+		e.depth++
+	case MapEnd:
+		e.depth--
+		e.writeIndent()
+		e.writeString("</map>")
+	case ArrayStart:
+		e.writeIndent()
+		e.writeString("<array>")
+		e.depth++
+	case ArrayEnd:
+		e.depth--
+		e.writeIndent()
+		e.writeString("</array>")
+	case Key:
+		e.writeIndent()
+		e.writeString("<key>")
+		if err := xml.EscapeText(e.w, []byte(tok)); err != nil {
 			return err
 		}
+		e.writeString("</key>")
+	case Scalar:
+		e.writeIndent()
+		if tok.Type == Undefined {
+			e.writeEmpty("undef")
+			return nil
+		}
+		e.writeString("<" + tok.Type.String())
+		names := make([]string, 0, len(tok.Attr))
+		for name := range tok.Attr {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			e.writeString(" " + name + "=\"")
+			if err := xml.EscapeText(e.w, []byte(tok.Attr[name])); err != nil {
+				return err
+			}
+			e.writeString("\"")
+		}
+		e.writeString(">")
+		if err := xml.EscapeText(e.w, tok.Data); err != nil {
+			return err
+		}
+		e.writeString("</" + tok.Type.String() + ">")
 	default:
-		return errors.New("Unknown encoding " + encoding)
+		return fmt.Errorf("LLSD: Cannot write token of type %T", tok)
 	}
 	return nil
 }
@@ -291,8 +1048,59 @@ func (e *XMLEncoder) writeString(s string) {
 	_, _ = e.w.WriteString(s)
 }
 
+// omitNil reports whether v, a map or struct value, is a nil slice to be
+// omitted under the NilSliceOmit policy.
+func (e *XMLEncoder) omitNil(v reflect.Value) bool {
+	if e.opts.NilSlices != NilSliceOmit {
+		return false
+	}
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v.Kind() == reflect.Slice && v.IsNil()
+}
+
+// writeEmpty writes an empty element in the configured self-closing style.
+func (e *XMLEncoder) writeEmpty(name string) {
+	if e.opts.TightEmpty {
+		e.writeString("<" + name + "/>")
+	} else {
+		e.writeString("<" + name + " />")
+	}
+}
+
 func (e *XMLEncoder) SetIndent(indent string) {
-	e.indent = indent
+	e.opts.Indent = indent
+}
+
+// SetBinaryEncoding sets the default text encoding of binary values (base16,
+// base64, base85). Encodings given in struct field tags take precedence.
+func (e *XMLEncoder) SetBinaryEncoding(encoding string) {
+	e.opts.BinaryEncoding = encoding
+}
+
+// SetFragment sets whether to omit the XML declaration and <llsd> root
+// element, writing only the encoded value. This is useful when embedding LLSD
+// into another XML document.
+func (e *XMLEncoder) SetFragment(fragment bool) {
+	e.opts.Fragment = fragment
+}
+
+// SetKeyFilter sets a function deciding whether a map or struct key and its
+// value are written. Keys for which filter returns false are skipped.
+func (e *XMLEncoder) SetKeyFilter(filter func(key string) bool) {
+	e.opts.KeyFilter = filter
+}
+
+// InjectFields sets extra keys to merge into the root map when encoding a
+// struct or map. Injected keys take precedence over keys of the same name.
+func (e *XMLEncoder) InjectFields(fields map[string]any) {
+	e.opts.InjectFields = fields
+}
+
+// Options returns a copy of the encoder's current options.
+func (e *XMLEncoder) Options() EncoderOptions {
+	return e.opts
 }
 
 // Flush flushes any buffered XML to the underlying writer
@@ -300,7 +1108,30 @@ func (e *XMLEncoder) Flush() {
 	e.w.Flush()
 }
 
+// Close flushes buffered output and marks the encoder done, after which
+// Encode returns ErrEncoderClosed. It does not close the underlying writer.
+func (e *XMLEncoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+	return e.out.err
+}
+
 func isEmptyValue(v reflect.Value) bool {
+	// Nil pointers and interfaces are empty without calling IsZero
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		return true
+	}
+	if v.Type().Implements(isZeroerType) {
+		return v.Interface().(isZeroer).IsZero()
+	}
+	if v.CanAddr() && reflect.PointerTo(v.Type()).Implements(isZeroerType) {
+		return v.Addr().Interface().(isZeroer).IsZero()
+	}
 	switch v.Kind() {
 	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
 		return v.Len() == 0
@@ -1,9 +1,20 @@
 package llsd
 
 import (
+	"bytes"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestXMLMarshal(t *testing.T) {
@@ -21,7 +32,7 @@ func TestXMLMarshal(t *testing.T) {
 		},
 		{
 			v:        []any{"a", 1, 1.0},
-			expected: "<array><string>a</string><integer>1</integer><real>1.000000</real></array>",
+			expected: "<array><string>a</string><integer>1</integer><real>1</real></array>",
 		},
 		{
 			v:        struct{ A []byte }{A: []byte("Binary data")},
@@ -142,8 +153,1106 @@ func TestXMLEncoding(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	expected = `<llsd><map><key>A</key><binary encoding="base85">6&gt;:=GEd8d&lt;@&lt;&gt;oX</binary></map></llsd>`
+	expected = `<llsd><map><key>A</key><binary encoding="base85">6&gt;:=GEd8d&lt;@&lt;&gt;o</binary></map></llsd>`
 	if !strings.Contains(string(b), expected) {
 		t.Fatalf("Expected %s, got %s", expected, string(b))
 	}
 }
+
+func TestXMLInjectFields(t *testing.T) {
+	src := struct {
+		A string
+	}{A: "a"}
+	var b bytes.Buffer
+	enc := NewXMLEncoder(&b)
+	enc.InjectFields(map[string]any{"version": 2})
+	if err := enc.Encode(&src); err != nil {
+		t.Fatal(err)
+	}
+	expected := "<llsd><map><key>version</key><integer>2</integer><key>A</key><string>a</string></map></llsd>"
+	if !strings.Contains(b.String(), expected) {
+		t.Fatalf("Expected %s, got %s", expected, b.String())
+	}
+}
+
+type upper string
+
+func (u upper) MarshalTextLLSD() (ScalarType, string, error) {
+	return String, strings.ToUpper(string(u)), nil
+}
+
+func TestXMLMarshalMapTextMarshaler(t *testing.T) {
+	src := map[string]upper{"a": "a"}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<llsd><map><key>a</key><string>A</string></map></llsd>"
+	if !strings.Contains(string(b), expected) {
+		t.Fatalf("Expected %s, got %s", expected, string(b))
+	}
+}
+
+func TestXMLBinaryEncodingDefault(t *testing.T) {
+	src := map[string][]byte{"a": []byte("Binary data")}
+	var b bytes.Buffer
+	enc := NewXMLEncoder(&b)
+	enc.SetBinaryEncoding(Base64)
+	if err := enc.Encode(&src); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<llsd><map><key>a</key><binary encoding="base64">QmluYXJ5IGRhdGE=</binary></map></llsd>`
+	if !strings.Contains(b.String(), expected) {
+		t.Fatalf("Expected %s, got %s", expected, b.String())
+	}
+}
+
+func TestXMLOmitEmptyUUIDAndURL(t *testing.T) {
+	src := struct {
+		ID  UUID `llsd:",omitempty"`
+		URI URL  `llsd:",omitempty"`
+	}{}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<llsd><map></map></llsd>"
+	if !strings.Contains(string(b), expected) {
+		t.Fatalf("Expected %s, got %s", expected, string(b))
+	}
+}
+
+func TestXMLFragment(t *testing.T) {
+	src := map[string]string{"a": "b"}
+	var b bytes.Buffer
+	enc := NewXMLEncoder(&b)
+	enc.SetFragment(true)
+	if err := enc.Encode(&src); err != nil {
+		t.Fatal(err)
+	}
+	expected := "<map><key>a</key><string>b</string></map>"
+	if b.String() != expected {
+		t.Fatalf("Expected %s, got %s", expected, b.String())
+	}
+
+	var dst map[string]string
+	if err := UnmarshalXML(b.Bytes(), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst["a"] != "b" {
+		t.Fatalf("Expected dst[a] to equal \"b\" but got %s", dst["a"])
+	}
+}
+
+func TestXMLMarshalJSONRawMessage(t *testing.T) {
+	src := map[string]json.RawMessage{
+		"a": json.RawMessage(`{"b": [1, 1.5, "c", true, null]}`),
+	}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<llsd><map><key>a</key><map><key>b</key><array><integer>1</integer><real>1.5</real><string>c</string><boolean>1</boolean><undef /></array></map></map></llsd>"
+	if !strings.Contains(string(b), expected) {
+		t.Fatalf("Expected %s, got %s", expected, string(b))
+	}
+
+	// Nil and empty documents are written as undef
+	b, err = MarshalXML(&struct {
+		Nil   json.RawMessage `llsd:"nil"`
+		Empty json.RawMessage `llsd:"empty"`
+	}{Empty: json.RawMessage{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"<key>nil</key><undef />", "<key>empty</key><undef />"} {
+		if !strings.Contains(string(b), expected) {
+			t.Fatalf("Expected %s, got %s", expected, string(b))
+		}
+	}
+}
+
+// decimal is a fixed-point number with two decimal places
+type decimal struct {
+	cents int64
+}
+
+func (d decimal) String() string {
+	return fmt.Sprintf("%d.%02d", d.cents/100, d.cents%100)
+}
+
+func (d decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *decimal) UnmarshalTextLLSD(b []byte) error {
+	var units, cents int64
+	if _, err := fmt.Sscanf(string(b), "%d.%d", &units, &cents); err != nil {
+		return err
+	}
+	d.cents = units*100 + cents
+	return nil
+}
+
+func TestXMLMarshalDecimal(t *testing.T) {
+	type T struct {
+		Text decimal
+		Real decimal `llsd:",real"`
+	}
+	src := T{Text: decimal{1234}, Real: decimal{505}}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"<key>Text</key><string>12.34</string>",
+		"<key>Real</key><real>5.05</real>",
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Fatalf("Expected %s, got %s", expected, string(b))
+		}
+	}
+
+	var dst T
+	if err := UnmarshalXML(b, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst != src {
+		t.Fatalf("Expected %v, got %v", src, dst)
+	}
+}
+
+func TestXMLMarshalPairs(t *testing.T) {
+	type T struct {
+		A map[string]int `llsd:",pairs"`
+	}
+	src := T{A: map[string]int{"a": 1, "b": 2}}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"<array><string>a</string><integer>1</integer></array>",
+		"<array><string>b</string><integer>2</integer></array>",
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Fatalf("Expected %s, got %s", expected, string(b))
+		}
+	}
+
+	var dst T
+	if err := UnmarshalXML(b, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if len(dst.A) != 2 || dst.A["a"] != 1 || dst.A["b"] != 2 {
+		t.Fatalf("Expected %v, got %v", src.A, dst.A)
+	}
+}
+
+func TestXMLLazyKeyFilter(t *testing.T) {
+	evaluated := map[string]bool{}
+	lazy := func(key string) Lazy {
+		return func() any {
+			evaluated[key] = true
+			return key
+		}
+	}
+	src := map[string]any{"a": lazy("a"), "b": lazy("b")}
+	var b bytes.Buffer
+	enc := NewXMLEncoder(&b)
+	enc.SetKeyFilter(func(key string) bool { return key == "a" })
+	if err := enc.Encode(&src); err != nil {
+		t.Fatal(err)
+	}
+	expected := "<llsd><map><key>a</key><string>a</string></map></llsd>"
+	if !strings.Contains(b.String(), expected) {
+		t.Fatalf("Expected %s, got %s", expected, b.String())
+	}
+	if !evaluated["a"] || evaluated["b"] {
+		t.Fatalf("Expected only lazy value a to be evaluated, got %v", evaluated)
+	}
+}
+
+func TestXMLMarshalBig(t *testing.T) {
+	type T struct {
+		Int   *big.Int
+		Int64 big.Int
+		Float *big.Float
+	}
+	src := T{Int: big.NewInt(42), Float: big.NewFloat(1.5)}
+	src.Int64.SetInt64(math.MaxInt64)
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"<key>Int</key><integer>42</integer>",
+		"<key>Int64</key><binary>7FFFFFFFFFFFFFFF</binary>",
+		"<key>Float</key><real>1.5</real>",
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Fatalf("Expected %s, got %s", expected, string(b))
+		}
+	}
+
+	var dst T
+	if err := UnmarshalXML(b, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Int.Cmp(src.Int) != 0 || dst.Int64.Cmp(&src.Int64) != 0 || dst.Float.Cmp(src.Float) != 0 {
+		t.Fatalf("Expected %v, got %v", src, dst)
+	}
+
+	var overflow big.Int
+	overflow.Lsh(big.NewInt(1), 64)
+	if _, err := MarshalXML(&overflow); !errorContains(err, "overflows 64 bits") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestXMLEncoderOptions(t *testing.T) {
+	src := map[string]bool{"b": false, "a": true}
+	var b bytes.Buffer
+	enc := NewXMLEncoderWith(&b, EncoderOptions{
+		Indent:          "  ",
+		SortKeys:        true,
+		LiteralBooleans: true,
+	})
+	if err := enc.Encode(&src); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<llsd>
+  <map>
+    <key>a</key>
+    <boolean>true</boolean>
+    <key>b</key>
+    <boolean>false</boolean>
+  </map>
+</llsd>`
+	if !strings.Contains(b.String(), expected) {
+		t.Fatalf("Expected %s, got %s", expected, b.String())
+	}
+	if opts := enc.Options(); opts.Indent != "  " || !opts.SortKeys || !opts.LiteralBooleans {
+		t.Fatalf("Expected options to be retained, got %+v", opts)
+	}
+}
+
+func TestXMLZeroTimeAsUndef(t *testing.T) {
+	src := struct{ Time time.Time }{}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<llsd><map><key>Time</key><date>0001-01-01T00:00:00Z</date></map></llsd>"
+	if !strings.Contains(string(b), expected) {
+		t.Fatalf("Expected %s, got %s", expected, string(b))
+	}
+
+	var buf bytes.Buffer
+	enc := NewXMLEncoderWith(&buf, EncoderOptions{ZeroTimeAsUndef: true})
+	if err := enc.Encode(&src); err != nil {
+		t.Fatal(err)
+	}
+	expected = "<llsd><map><key>Time</key><undef /></map></llsd>"
+	if !strings.Contains(buf.String(), expected) {
+		t.Fatalf("Expected %s, got %s", expected, buf.String())
+	}
+}
+
+func TestXMLTagPrecedence(t *testing.T) {
+	src := struct {
+		A string `llsd:"a" json:"b,omitempty"`
+		C string `json:"c,omitempty"`
+		D string `llsd:"" json:"d"`
+	}{}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"<key>a</key><string></string>", "<key>D</key><string></string>"} {
+		if !strings.Contains(string(b), expected) {
+			t.Fatalf("Expected %s, got %s", expected, string(b))
+		}
+	}
+	for _, unexpected := range []string{"<key>b</key>", "<key>c</key>", "<key>d</key>"} {
+		if strings.Contains(string(b), unexpected) {
+			t.Fatalf("Expected %s to be omitted, got %s", unexpected, string(b))
+		}
+	}
+}
+
+func TestXMLMaxOutputBytes(t *testing.T) {
+	v := make([]string, 10000)
+	for i := range v {
+		v[i] = "value"
+	}
+	var b bytes.Buffer
+	enc := NewXMLEncoderWith(&b, EncoderOptions{MaxOutputBytes: 1024})
+	if err := enc.Encode(v); err != ErrOutputLimit {
+		t.Fatalf("Expected ErrOutputLimit but got %v", err)
+	}
+	if b.Len() > 1024 {
+		t.Fatalf("Expected at most 1024 bytes written but got %d", b.Len())
+	}
+
+	// The limit applies to each value, so the encoder recovers
+	b.Reset()
+	if err := enc.Encode(v[:2]); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<llsd><array><string>value</string><string>value</string></array></llsd>`
+	if b.String() != expected {
+		t.Fatalf("Expected %s, got %s", expected, b.String())
+	}
+
+	b.Reset()
+	enc = NewXMLEncoderWith(&b, EncoderOptions{MaxOutputBytes: 1024})
+	if err := enc.Encode(v[:10]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type zeroable struct {
+	Value string
+	Zero  bool
+}
+
+func (z zeroable) IsZero() bool {
+	return z.Zero
+}
+
+func TestXMLOmitEmptyIsZero(t *testing.T) {
+	src := struct {
+		A zeroable                   `llsd:"a,omitempty"`
+		B zeroable                   `llsd:"b,omitempty"`
+		C time.Time                  `llsd:"c,omitempty"`
+		D interface{ IsZero() bool } `llsd:"d,omitempty"`
+	}{
+		A: zeroable{Value: "a", Zero: true},
+		B: zeroable{Value: "b"},
+	}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "<key>a</key>") {
+		t.Fatalf("Expected a to be omitted, got %s", b)
+	}
+	if !strings.Contains(string(b), "<key>b</key>") {
+		t.Fatalf("Expected b to be present, got %s", b)
+	}
+	if strings.Contains(string(b), "<key>c</key>") {
+		t.Fatalf("Expected zero time c to be omitted, got %s", b)
+	}
+	if strings.Contains(string(b), "<key>d</key>") {
+		t.Fatalf("Expected nil interface d to be omitted, got %s", b)
+	}
+}
+
+func TestXMLMarshalInterfaceScalars(t *testing.T) {
+	src := map[string]any{
+		"date":   time.Date(2006, 2, 1, 14, 29, 53, 0, time.UTC),
+		"id":     UUID{0x67, 0x15, 0x3d, 0x5b},
+		"uri":    URL("http://example.org"),
+		"binary": []byte("Binary data"),
+	}
+	b, err := MarshalXML(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"<key>date</key><date>2006-02-01T14:29:53Z</date>",
+		"<key>id</key><uuid>67153d5b000000000000000000000000</uuid>",
+		"<key>uri</key><uri>http://example.org</uri>",
+		"<key>binary</key><binary>42696E6172792064617461</binary>",
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Fatalf("Expected %s, got %s", expected, b)
+		}
+	}
+}
+
+// point writes itself as a map with computed keys
+type point struct {
+	X, Y int
+}
+
+func (p point) MarshalLLSD(w TokenWriter) error {
+	for _, tok := range []Token{
+		MapStart{},
+		Key("x"), Scalar{Type: Integer, Data: []byte(fmt.Sprint(p.X))},
+		Key("y"), Scalar{Type: Integer, Data: []byte(fmt.Sprint(p.Y))},
+		MapEnd{},
+	} {
+		if err := w.WriteToken(tok); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *point) UnmarshalLLSD(r TokenReader) error {
+	var key Key
+	for {
+		tok, err := r.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case Key:
+			key = tok
+		case Scalar:
+			n, err := strconv.Atoi(string(tok.Data))
+			if err != nil {
+				return err
+			}
+			if key == "x" {
+				p.X = n
+			} else {
+				p.Y = n
+			}
+		}
+	}
+}
+
+func TestXMLMarshalLLSD(t *testing.T) {
+	src := struct {
+		P    point  `llsd:"p"`
+		Next string `llsd:"next"`
+	}{P: point{1, 2}, Next: "n"}
+	var b bytes.Buffer
+	enc := NewXMLEncoderWith(&b, EncoderOptions{SortKeys: true})
+	if err := enc.Encode(&src); err != nil {
+		t.Fatal(err)
+	}
+	expected := "<map><key>next</key><string>n</string><key>p</key><map><key>x</key><integer>1</integer><key>y</key><integer>2</integer></map></map>"
+	if !strings.Contains(b.String(), expected) {
+		t.Fatalf("Expected %s, got %s", expected, b.String())
+	}
+
+	// The value is read back through UnmarshalLLSD
+	var dst struct {
+		P    point  `llsd:"p"`
+		Next string `llsd:"next"`
+	}
+	if err := UnmarshalXML(b.Bytes(), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.P != src.P || dst.Next != "n" {
+		t.Fatalf("Expected dst to equal %v but got %v", src, dst)
+	}
+}
+
+func TestXMLNilAndEmptyBinary(t *testing.T) {
+	type T struct {
+		Absent []byte `llsd:"absent,omitempty"`
+		Empty  []byte `llsd:"empty"`
+	}
+	b, err := MarshalXML(&T{Empty: []byte{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<llsd><map><key>empty</key><binary /></map></llsd>"
+	if !strings.Contains(string(b), expected) {
+		t.Fatalf("Expected %s, got %s", expected, b)
+	}
+
+	var dst T
+	if err := UnmarshalXML(b, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Absent != nil {
+		t.Fatalf("Expected dst.Absent to be nil but got %v", dst.Absent)
+	}
+	if dst.Empty == nil || len(dst.Empty) != 0 {
+		t.Fatalf("Expected dst.Empty to be a non-nil empty slice but got %#v", dst.Empty)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, expected := range map[string]string{
+		"RegionID":     "region_id",
+		"SimFPS":       "sim_fps",
+		"HTTPServer":   "http_server",
+		"TimeDilation": "time_dilation",
+		"X":            "x",
+		"Version2Name": "version2_name",
+	} {
+		if got := SnakeCase(name); got != expected {
+			t.Errorf("Expected SnakeCase(%q) to equal %q but got %q", name, expected, got)
+		}
+	}
+}
+
+func TestXMLFieldName(t *testing.T) {
+	type stats struct {
+		RegionID     UUID
+		TimeDilation float64
+		Scale        string `llsd:"scale_name"`
+	}
+	src := stats{RegionID: UUID{1}, TimeDilation: 0.5, Scale: "one minute"}
+	var b bytes.Buffer
+	if err := NewXMLEncoderWith(&b, EncoderOptions{FieldName: SnakeCase}).Encode(&src); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"<key>region_id</key>", "<key>time_dilation</key>", "<key>scale_name</key>"} {
+		if !strings.Contains(b.String(), expected) {
+			t.Fatalf("Expected %s, got %s", expected, b.String())
+		}
+	}
+
+	var dst stats
+	dec := NewXMLDecoderWith(bytes.NewReader(b.Bytes()), DecoderOptions{FieldName: SnakeCase, DisallowUnknownFields: true})
+	if err := dec.Unmarshal(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst != src {
+		t.Fatalf("Expected dst to equal %v but got %v", src, dst)
+	}
+
+	// Closures sharing code are distinct FieldName functions
+	prefix := func(p string) func(string) string {
+		return func(name string) string { return p + name }
+	}
+	for _, p := range []string{"a_", "b_"} {
+		b.Reset()
+		if err := NewXMLEncoderWith(&b, EncoderOptions{FieldName: prefix(p)}).Encode(&src); err != nil {
+			t.Fatal(err)
+		}
+		if expected := "<key>" + p + "RegionID</key>"; !strings.Contains(b.String(), expected) {
+			t.Fatalf("Expected %s, got %s", expected, b.String())
+		}
+	}
+}
+
+func TestXMLEpochTime(t *testing.T) {
+	type T struct {
+		Date  time.Time `llsd:"date"`
+		Epoch time.Time `llsd:"epoch,epoch"`
+	}
+	src := T{
+		Date:  time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC),
+		Epoch: time.Date(2023, 5, 1, 12, 0, 0, 1953125, time.UTC),
+	}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"<key>date</key><date>2023-05-01T12:00:00Z</date>",
+		"<key>epoch</key><real>1682942400.0019531</real>",
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Fatalf("Expected %s, got %s", expected, b)
+		}
+	}
+
+	var dst T
+	dec := NewXMLDecoderWith(bytes.NewReader(b), DecoderOptions{StrictTypes: true})
+	if err := dec.Unmarshal(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if !dst.Date.Equal(src.Date) || !dst.Epoch.Equal(src.Epoch) {
+		t.Fatalf("Expected %v but got %v", src, dst)
+	}
+
+	// Decimal fractions round to the nearest nanosecond
+	for _, epoch := range []time.Time{time.Unix(1, 1000000), time.Unix(1, 999999999)} {
+		src.Epoch = epoch.UTC()
+		b, err := MarshalXML(&src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := UnmarshalXML(b, &dst); err != nil {
+			t.Fatal(err)
+		}
+		if !dst.Epoch.Equal(src.Epoch) {
+			t.Fatalf("Expected %v but got %v", src.Epoch, dst.Epoch)
+		}
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>epoch</key><real>1.9999999999</real></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if !dst.Epoch.Equal(time.Unix(2, 0)) {
+		t.Fatalf("Expected rounding to carry into the next second but got %v", dst.Epoch)
+	}
+}
+
+func TestXMLIPAndDuration(t *testing.T) {
+	type T struct {
+		IP      net.IP        `llsd:"ip"`
+		Timeout time.Duration `llsd:"timeout"`
+	}
+	src := T{IP: net.ParseIP("10.0.0.1").To4(), Timeout: 1500*time.Millisecond + 1500}
+	for _, c := range []struct {
+		opts     EncoderOptions
+		expected string
+	}{
+		{EncoderOptions{}, "<key>timeout</key><real>1.5000015</real>"},
+		{EncoderOptions{DurationNanos: true}, "<key>timeout</key><integer>1500001500</integer>"},
+	} {
+		var b bytes.Buffer
+		if err := NewXMLEncoderWith(&b, c.opts).Encode(&src); err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{"<key>ip</key><binary>0A000001</binary>", c.expected} {
+			if !strings.Contains(b.String(), expected) {
+				t.Fatalf("Expected %s, got %s", expected, b.String())
+			}
+		}
+
+		var dst T
+		if err := UnmarshalXML(b.Bytes(), &dst); err != nil {
+			t.Fatal(err)
+		}
+		if !dst.IP.Equal(src.IP) || dst.Timeout != src.Timeout {
+			t.Fatalf("Expected %v but got %v", src, dst)
+		}
+	}
+
+	// IP addresses in text form are accepted
+	var dst T
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>ip</key><string>::1</string></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if !dst.IP.Equal(net.IPv6loopback) {
+		t.Fatalf("Expected ::1 but got %v", dst.IP)
+	}
+
+	// Fractions of a second that are not binary round trip exactly
+	src.Timeout = 1001 * time.Millisecond
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UnmarshalXML(b, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Timeout != src.Timeout {
+		t.Fatalf("Expected %v but got %v", src.Timeout, dst.Timeout)
+	}
+
+	// Seconds out of range of a Duration are rejected
+	for _, value := range []string{"1e12", "-1e12", "nan"} {
+		xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>timeout</key><real>` + value + `</real></map></llsd>`
+		var typeErr *UnmarshalTypeError
+		if err := UnmarshalXML([]byte(xml), &dst); !errors.As(err, &typeErr) {
+			t.Fatalf("%s: expected UnmarshalTypeError but got %v", value, err)
+		}
+	}
+}
+
+func TestXMLEncoderClose(t *testing.T) {
+	var b bytes.Buffer
+	enc := NewXMLEncoder(&b)
+	if err := enc.Encode(map[string]int{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(map[string]int{"b": 2}); err != ErrEncoderClosed {
+		t.Fatalf("Expected ErrEncoderClosed but got %v", err)
+	}
+	if n := strings.Count(b.String(), "<llsd>"); n != 1 {
+		t.Fatalf("Expected a single document but got %d: %s", n, b.String())
+	}
+}
+
+func TestXMLURIEscaping(t *testing.T) {
+	type T struct {
+		URI  URL     `llsd:"uri"`
+		Link url.URL `llsd:"link"`
+	}
+	src := T{
+		URI:  URL("http://example.com/a b?q=é&r=%20"),
+		Link: url.URL{Scheme: "http", Host: "example.com", Path: "/a b"},
+	}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"<key>uri</key><uri>http://example.com/a%20b?q=%C3%A9&amp;r=%20</uri>",
+		"<key>link</key><uri>http://example.com/a%20b</uri>",
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Fatalf("Expected %s, got %s", expected, b)
+		}
+	}
+
+	var dst T
+	dec := NewXMLDecoderWith(bytes.NewReader(b), DecoderOptions{ValidateURIs: true})
+	if err := dec.Unmarshal(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.URI != "http://example.com/a%20b?q=%C3%A9&r=%20" {
+		t.Fatalf("Expected escaped URI but got %s", dst.URI)
+	}
+	if dst.Link.Path != "/a b" || dst.Link.Host != "example.com" {
+		t.Fatalf("Expected link path \"/a b\" but got %v", dst.Link)
+	}
+
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>uri</key><uri>http://[::1</uri></map></llsd>`
+	dec = NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{ValidateURIs: true})
+	if err := dec.Unmarshal(&dst); err == nil {
+		t.Fatal("Expected invalid URI to fail validation")
+	}
+
+	// URIs are accepted by string fields and rejected by other kinds
+	var text struct {
+		URI string `llsd:"uri"`
+	}
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>uri</key><uri>http://example.com</uri></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &text); err != nil {
+		t.Fatal(err)
+	}
+	if text.URI != "http://example.com" {
+		t.Fatalf("Expected http://example.com but got %s", text.URI)
+	}
+	var number struct {
+		URI int `llsd:"uri"`
+	}
+	var typeErr *UnmarshalTypeError
+	if err := UnmarshalXML([]byte(xml), &number); !errors.As(err, &typeErr) {
+		t.Fatalf("Expected UnmarshalTypeError but got %v", err)
+	}
+}
+
+func TestXMLIntArray(t *testing.T) {
+	type T struct {
+		Channels []byte `llsd:"channels,intarray"`
+	}
+	src := T{Channels: []byte{1, 2, 255}}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<key>channels</key><array><integer>1</integer><integer>2</integer><integer>255</integer></array>"
+	if !strings.Contains(string(b), expected) {
+		t.Fatalf("Expected %s, got %s", expected, b)
+	}
+
+	var dst T
+	if err := UnmarshalXML(b, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst.Channels, src.Channels) {
+		t.Fatalf("Expected %v but got %v", src.Channels, dst.Channels)
+	}
+
+	for _, value := range []string{"256", "-1"} {
+		xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>channels</key><array><integer>` + value + `</integer></array></map></llsd>`
+		if err := UnmarshalXML([]byte(xml), &dst); !errorContains(err, "Cannot unmarshal integer "+value) {
+			t.Fatalf("Expected %s to be out of range but got %v", value, err)
+		}
+	}
+}
+
+func TestXMLTupleStruct(t *testing.T) {
+	type Vector struct {
+		X float64 `llsd:",index=0"`
+		Y float64
+		Z float64
+	}
+	type T struct {
+		Pos Vector `llsd:"pos"`
+	}
+	src := T{Pos: Vector{1.5, 2, -3}}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<key>pos</key><array><real>1.5</real><real>2</real><real>-3</real></array>"
+	if !strings.Contains(string(b), expected) {
+		t.Fatalf("Expected %s, got %s", expected, b)
+	}
+
+	var dst T
+	if err := UnmarshalXML(b, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst != src {
+		t.Fatalf("Expected %v but got %v", src, dst)
+	}
+
+	// Positions without a field are written as undef and skipped
+	type Sparse struct {
+		A int `llsd:",index=0"`
+		C int `llsd:",index=2"`
+	}
+	b, err = MarshalXML(&Sparse{A: 1, C: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "<array><integer>1</integer><undef /><integer>3</integer></array>"
+	if !strings.Contains(string(b), expected) {
+		t.Fatalf("Expected %s, got %s", expected, b)
+	}
+	var sparse Sparse
+	if err := UnmarshalXML([]byte(`<?xml version="1.0" encoding="UTF-8"?><llsd><array><integer>1</integer><integer>2</integer><integer>3</integer></array></llsd>`), &sparse); err != nil {
+		t.Fatal(err)
+	}
+	if sparse != (Sparse{A: 1, C: 3}) {
+		t.Fatalf("Expected {1 3} but got %v", sparse)
+	}
+
+	// Structs without positional fields reject arrays
+	var private struct {
+		a int
+	}
+	err = UnmarshalXML([]byte(`<?xml version="1.0" encoding="UTF-8"?><llsd><array><integer>1</integer></array></llsd>`), &private)
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("Expected UnmarshalTypeError but got %v", err)
+	}
+
+	// Positions may not overlap or exceed the index limit
+	type Overlap struct {
+		A int `llsd:",index=1"`
+		B int
+		C int `llsd:",index=1"`
+	}
+	if _, err := MarshalXML(&Overlap{}); !errorContains(err, "fields A and C of llsd.Overlap share array index 1") {
+		t.Fatalf("Expected overlapping index error but got %v", err)
+	}
+	var overlap Overlap
+	err = UnmarshalXML([]byte(`<?xml version="1.0" encoding="UTF-8"?><llsd><array><integer>1</integer></array></llsd>`), &overlap)
+	if !errorContains(err, "share array index 1") {
+		t.Fatalf("Expected overlapping index error but got %v", err)
+	}
+	type Huge struct {
+		A int `llsd:",index=1000000000"`
+	}
+	if _, err := MarshalXML(&Huge{}); !errorContains(err, "array index 1000000000 of field A of llsd.Huge exceeds 1024") {
+		t.Fatalf("Expected index limit error but got %v", err)
+	}
+}
+
+func TestXMLIndentGolden(t *testing.T) {
+	type T struct {
+		Name  string  `llsd:"name"`
+		Value *int    `llsd:"value"`
+		Data  []byte  `llsd:"data"`
+		List  []int32 `llsd:"list"`
+	}
+	src := T{Name: "a", Data: []byte{}, List: []int32{1, 2}}
+	for _, c := range []struct {
+		tight    bool
+		expected string
+	}{
+		{false, `<?xml version="1.0" encoding="UTF-8"?>
+<llsd>
+  <map>
+    <key>data</key>
+    <binary />
+    <key>list</key>
+    <array>
+      <integer>1</integer>
+      <integer>2</integer>
+    </array>
+    <key>name</key>
+    <string>a</string>
+    <key>value</key>
+    <undef />
+  </map>
+</llsd>`},
+		{true, `<?xml version="1.0" encoding="UTF-8"?>
+<llsd>
+  <map>
+    <key>data</key>
+    <binary/>
+    <key>list</key>
+    <array>
+      <integer>1</integer>
+      <integer>2</integer>
+    </array>
+    <key>name</key>
+    <string>a</string>
+    <key>value</key>
+    <undef/>
+  </map>
+</llsd>`},
+	} {
+		var b bytes.Buffer
+		enc := NewXMLEncoderWith(&b, EncoderOptions{Indent: "  ", SortKeys: true, TightEmpty: c.tight})
+		if err := enc.Encode(&src); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != c.expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", c.expected, b.String())
+		}
+	}
+}
+
+func TestCanonicalXML(t *testing.T) {
+	a := map[string]any{}
+	b := map[string]any{}
+	keys := []string{"zeta", "alpha", "mid", "beta", "omega", "gamma"}
+	for i, key := range keys {
+		a[key] = i
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		b[keys[i]] = map[string]any{"x": 1.5, "a": []byte("hi"), "flag": true}
+		a[keys[i]] = map[string]any{"flag": true, "a": []byte("hi"), "x": 1.5}
+	}
+	first, err := CanonicalXML(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		for _, v := range []any{a, b} {
+			out, err := CanonicalXML(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, first) {
+				t.Fatalf("Expected %s, got %s", first, out)
+			}
+		}
+	}
+	expected := `<map><key>a</key><binary encoding="base64">aGk=</binary><key>flag</key><boolean>1</boolean><key>x</key><real>1.5</real></map>`
+	if !strings.Contains(string(first), expected) {
+		t.Fatalf("Expected %s, got %s", expected, first)
+	}
+
+	// Pairs and extras are sorted with the rest of the document
+	type T struct {
+		Name   string         `llsd:"name"`
+		Pairs  map[int]string `llsd:"pairs,pairs"`
+		Extras map[string]any `llsd:",extras"`
+	}
+	src := T{Name: "n", Pairs: map[int]string{}, Extras: map[string]any{}}
+	for i := 9; i >= 0; i-- {
+		src.Pairs[i] = strconv.Itoa(i)
+		src.Extras["extra"+strconv.Itoa(i)] = 1.0 / 3
+	}
+	out, err := CanonicalXML(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		again, err := CanonicalXML(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(again, out) {
+			t.Fatalf("Expected %s, got %s", out, again)
+		}
+	}
+	for _, expected := range []string{
+		`<map><key>extra0</key><real>0.3333333333333333</real><key>extra1</key>`,
+		`<key>extra9</key><real>0.3333333333333333</real><key>name</key><string>n</string><key>pairs</key>`,
+		`<array><array><integer>0</integer><string>0</string></array><array><integer>1</integer><string>1</string></array>`,
+	} {
+		if !strings.Contains(string(out), expected) {
+			t.Fatalf("Expected %s, got %s", expected, out)
+		}
+	}
+}
+
+func TestXMLNilSlices(t *testing.T) {
+	src := struct {
+		Nil   []int `llsd:"nil"`
+		Empty []int `llsd:"empty"`
+	}{Empty: []int{}}
+	for _, c := range []struct {
+		policy   NilSlicePolicy
+		expected string
+	}{
+		{NilSliceEmpty, "<map><key>empty</key><array></array><key>nil</key><array></array></map>"},
+		{NilSliceOmit, "<map><key>empty</key><array></array></map>"},
+		{NilSliceUndef, "<map><key>empty</key><array></array><key>nil</key><undef /></map>"},
+	} {
+		var b bytes.Buffer
+		if err := NewXMLEncoderWith(&b, EncoderOptions{NilSlices: c.policy, SortKeys: true}).Encode(&src); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(b.String(), c.expected) {
+			t.Fatalf("Expected %s, got %s", c.expected, b.String())
+		}
+	}
+
+	var b bytes.Buffer
+	m := map[string]any{"nil": []any(nil)}
+	if err := NewXMLEncoderWith(&b, EncoderOptions{NilSlices: NilSliceOmit}).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "<map></map>") {
+		t.Fatalf("Expected nil slice to be omitted from map, got %s", b.String())
+	}
+}
+
+func TestAppendXML(t *testing.T) {
+	src := struct {
+		A string `llsd:"a"`
+	}{A: "b"}
+	expected, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 0, 1024)
+	buf = append(buf, "prefix"...)
+	out, err := AppendXML(buf, &src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "prefix"+string(expected) {
+		t.Fatalf("Expected prefix%s, got %s", expected, out)
+	}
+	if &out[0] != &buf[0] {
+		t.Fatal("Expected AppendXML to reuse the buffer with spare capacity")
+	}
+}
+
+func TestXMLEncodeCycle(t *testing.T) {
+	m := map[string]any{"a": 1}
+	m["self"] = m
+	_, err := MarshalXML(m)
+	if !errors.Is(err, ErrCycle) || !errorContains(err, "cycle detected") {
+		t.Fatalf("Expected cycle to be detected but got %v", err)
+	}
+
+	// Values repeated without a cycle are written
+	shared := []any{1}
+	if _, err := MarshalXML(map[string]any{"a": shared, "b": shared}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestXMLFixedArrays(t *testing.T) {
+	type T struct {
+		Pos   [3]float64 `llsd:"pos"`
+		Size  [2]int     `llsd:"size"`
+		Color [4]byte    `llsd:"color,intarray"`
+		Hash  [2]byte    `llsd:"hash"`
+	}
+	src := T{Pos: [3]float64{1, 2.5, 3}, Size: [2]int{4, 5}, Color: [4]byte{255, 128, 0, 1}, Hash: [2]byte{0xab, 0xcd}}
+	b, err := MarshalXML(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"<key>pos</key><array><real>1</real><real>2.5</real><real>3</real></array>",
+		"<key>size</key><array><integer>4</integer><integer>5</integer></array>",
+		"<key>color</key><array><integer>255</integer><integer>128</integer><integer>0</integer><integer>1</integer></array>",
+		"<key>hash</key><binary>ABCD</binary>",
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Fatalf("Expected %s, got %s", expected, b)
+		}
+	}
+
+	var dst T
+	if err := UnmarshalXML(b, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst != src {
+		t.Fatalf("Expected %v but got %v", src, dst)
+	}
+}
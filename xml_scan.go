@@ -7,8 +7,13 @@ import (
 	"reflect"
 )
 
+// XMLScanner reads LLSD tokens from XML. It tracks the open llsd, map and
+// array elements itself, rather than relying on Go's xml decoder, so that
+// mismatched close tags are reported as InvalidLLSDError.
 type XMLScanner struct {
-	dec *xml.Decoder
+	dec  *xml.Decoder
+	buf  []byte   // reused inner-text buffer
+	open []string // names of open container elements, innermost last
 }
 
 func NewXMLScanner(r io.Reader) *XMLScanner {
@@ -20,30 +25,79 @@ func (s *XMLScanner) Offset() int64 {
 	return s.dec.InputOffset()
 }
 
-func (s *XMLScanner) charData() ([]byte, error) {
-	// Attempt to get CharData (inner-text)
-	t, err := s.dec.Token()
-	if err != nil {
-		return nil, err
+// charData reads the inner-text of the element name up to and including its
+// EndElement. Go's xml decoder may split inner-text into several CharData
+// tokens, such as around CDATA sections, so they are accumulated. The returned
+// slice is only valid until the next call.
+func (s *XMLScanner) charData(name string) ([]byte, error) {
+	data := s.buf[:0]
+	defer func() { s.buf = data }()
+	for {
+		t, err := s.rawToken()
+		if err != nil {
+			return data, err
+		}
+		switch ty := t.(type) {
+		case xml.CharData:
+			data = append(data, ty...)
+		case xml.Comment:
+			// Skip comments within inner-text
+		case xml.EndElement:
+			if ty.Name.Local != name {
+				return data, &InvalidLLSDError{Problem: fmt.Sprintf("<%s> closed by </%s>", name, ty.Name.Local), Offset: s.Offset()}
+			}
+			return data, nil
+		default:
+			return data, fmt.Errorf("Invalid LLSD: got unexpected %s", reflect.TypeOf(t))
+		}
 	}
-	switch ty := t.(type) {
-	case xml.CharData:
-		return ty, nil
-	case xml.EndElement:
-		// Handle self-closing elements
-		return nil, nil
-	default:
-		return nil, fmt.Errorf("Invalid LLSD: got unexpected %s", reflect.TypeOf(t))
+}
+
+// rawToken reads the next XML token without Go's matching of start and end
+// elements, reporting the end of input within an open element.
+func (s *XMLScanner) rawToken() (xml.Token, error) {
+	tok, err := s.dec.RawToken()
+	if err == io.EOF && len(s.open) > 0 {
+		return nil, &InvalidLLSDError{Problem: fmt.Sprintf("unexpected end of input in <%s>", s.open[len(s.open)-1]), Offset: s.Offset()}
 	}
+	return tok, err
 }
 
-// Skip element, useful for jumping over large maps and arrays.
+// close pops the open container element closed by the element name.
+func (s *XMLScanner) close(name string) error {
+	if len(s.open) == 0 {
+		return &InvalidLLSDError{Problem: fmt.Sprintf("unexpected </%s>", name), Offset: s.Offset()}
+	}
+	open := s.open[len(s.open)-1]
+	if open != name {
+		return &InvalidLLSDError{Problem: fmt.Sprintf("<%s> closed by </%s>", open, name), Offset: s.Offset()}
+	}
+	s.open = s.open[:len(s.open)-1]
+	return nil
+}
+
+// Skip the remainder of the innermost open element, useful for jumping over
+// large maps and arrays.
 func (s *XMLScanner) Skip() error {
-	return s.dec.Skip()
+	for depth := len(s.open); len(s.open) >= depth; {
+		tok, err := s.rawToken()
+		if err != nil {
+			return err
+		}
+		switch ty := tok.(type) {
+		case xml.StartElement:
+			s.open = append(s.open, ty.Name.Local)
+		case xml.EndElement:
+			if err := s.close(ty.Name.Local); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 func (s *XMLScanner) Token() (Token, error) {
-	tok, err := s.dec.Token()
+	tok, err := s.rawToken()
 
 	if err != nil {
 		return nil, err
@@ -53,66 +107,49 @@ func (s *XMLScanner) Token() (Token, error) {
 	case xml.StartElement:
 		switch ty.Name.Local {
 		case "array":
+			s.open = append(s.open, ty.Name.Local)
 			return ArrayStart{}, nil
 		case "map":
+			s.open = append(s.open, ty.Name.Local)
 			return MapStart{}, nil
 		case "key":
-			b, err := s.charData()
-			key := Key(b)
-			if err != nil {
-				return key, err
-			}
-			// Advanced past </key> EndElement, which is always provided by go's xml decoding
-			_, err = s.dec.Token()
-
-			return key, err
+			b, err := s.charData(ty.Name.Local)
+			return Key(b), err
 		case "llsd":
 			// Skip document start
+			s.open = append(s.open, ty.Name.Local)
 			return s.Token()
 		default:
-			scalarTypes := map[string]ScalarType{
-				"string":  String,
-				"real":    Real,
-				"uuid":    UUIDType,
-				"integer": Integer,
-				"boolean": Boolean,
-				"undef":   Undefined,
-				"binary":  Binary,
-				"uri":     URI,
-				"date":    Date,
-			}
-
-			scalarType, ok := scalarTypes[ty.Name.Local]
-
-			if !ok {
-				return nil, fmt.Errorf("Unknown LLSD type \"%s\"", ty.Name.Local)
+			scalarType, err := ParseScalarType(ty.Name.Local)
+			if err != nil {
+				return nil, err
 			}
 
-			// Copy data so that it is not overwritten when advancing past end element
-			innerText, err := s.charData()
+			// Copy data so that it is not overwritten by the next element
+			innerText, err := s.charData(ty.Name.Local)
 			data := make([]byte, len(innerText))
 			copy(data, innerText)
 
-			// Map XML attributes (<binary encoding="base64">)
-			attr := map[string]string{}
-			for _, a := range ty.Attr {
-				attr[a.Name.Local] = a.Value
+			// Map XML attributes (<binary encoding="base64">), leaving Attr nil
+			// for the common case of an element without attributes
+			var attr map[string]string
+			if len(ty.Attr) > 0 {
+				attr = make(map[string]string, len(ty.Attr))
+				for _, a := range ty.Attr {
+					attr[a.Name.Local] = a.Value
+				}
 			}
 
 			if err != nil {
 				return nil, err
 			}
 
-			// If innerText is nil then the element is self-closing and we have
-			// already advanced past its EndElement.
-			if innerText != nil {
-				// Advanced past EndElement, which is always provided by go's xml decoding
-				_, err = s.dec.Token()
-			}
-
-			return Scalar{Type: scalarType, Data: data, Attr: attr}, err
+			return Scalar{Type: scalarType, Data: data, Attr: attr}, nil
 		}
 	case xml.EndElement:
+		if err := s.close(ty.Name.Local); err != nil {
+			return nil, err
+		}
 		switch ty.Name.Local {
 		case "array":
 			return ArrayEnd{}, nil
@@ -2,10 +2,16 @@ package llsd
 
 import (
 	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"errors"
 	"io"
+	"os"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -41,36 +47,8 @@ func testScan(t *testing.T, scanner TokenReader, expected []Token) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		gotType := reflect.TypeOf(got)
-		elType := reflect.TypeOf(el)
-		if gotType != elType {
-			t.Fatalf("Expected element %d to be type %s, got %s", i, reflect.TypeOf(el), reflect.TypeOf(got))
-		}
-		switch el.(type) {
-		case Key:
-			if el != got {
-				t.Fatalf("Expected key %s=%s", el, got)
-			}
-		case Scalar:
-			expectedScalar := el.(Scalar)
-			gotScalar := got.(Scalar)
-			if expectedScalar.Type != gotScalar.Type {
-				t.Fatalf("Expected element %d to have scalar type %s but got %s", i, expectedScalar.Type, gotScalar.Type)
-			}
-			if !bytes.Equal(expectedScalar.Data, gotScalar.Data) {
-				t.Fatalf("Expected element %d to have value \"%s\" but got \"%s\"", i, expectedScalar.Data, gotScalar.Data)
-			}
-			if len(expectedScalar.Attr) > 0 {
-				for k, v := range expectedScalar.Attr {
-					gotVal, ok := gotScalar.Attr[k]
-					if !ok {
-						t.Fatalf("Expected element %d to have attribute %s", i, k)
-					}
-					if v != gotVal {
-						t.Fatalf("Expected element %d attribute %s to equal %s but got %s", i, k, v, gotVal)
-					}
-				}
-			}
+		if !el.(interface{ Equal(Token) bool }).Equal(got) {
+			t.Fatalf("Expected element %d to be %s, got %s", i, el, got)
 		}
 	}
 	_, err := scanner.Token()
@@ -79,38 +57,40 @@ func testScan(t *testing.T, scanner TokenReader, expected []Token) {
 	}
 }
 
+// xmlStrTokens are the tokens scanned from xmlStr
+var xmlStrTokens = []Token{
+	MapStart{},
+	Key("region_id"),
+	Scalar{Type: UUIDType, Data: []byte("67153d5b-3659-afb4-8510-adda2c034649")},
+	Key("scale"),
+	Scalar{Type: String, Data: []byte("one minute")},
+	Key("simulator statistics"),
+	MapStart{},
+	Key("time dilation"),
+	Scalar{Type: Real, Data: []byte("0.9878624")},
+	MapEnd{},
+	Key("array example"),
+	ArrayStart{},
+	Scalar{Type: Real, Data: []byte("100.1")},
+	Scalar{Type: Real},
+	ArrayEnd{},
+	Key("binary examples"),
+	MapStart{},
+	Key("empty binary"),
+	Scalar{Type: Binary},
+	Key("base16"),
+	Scalar{Type: Binary, Data: []byte("42696e6172792064617461"), Attr: map[string]string{"encoding": "base16"}},
+	Key("base64"),
+	Scalar{Type: Binary, Data: []byte("QmluYXJ5IGRhdGE="), Attr: map[string]string{"encoding": "base64"}},
+	Key("base85"),
+	Scalar{Type: Binary, Data: []byte("6>:=GEd8d<@<>o"), Attr: map[string]string{"encoding": "base85"}},
+	MapEnd{},
+	MapEnd{},
+}
+
 func TestXMLScan(t *testing.T) {
-	expected := []Token{
-		MapStart{},
-		Key("region_id"),
-		Scalar{Type: UUIDType, Data: []byte("67153d5b-3659-afb4-8510-adda2c034649")},
-		Key("scale"),
-		Scalar{Type: String, Data: []byte("one minute")},
-		Key("simulator statistics"),
-		MapStart{},
-		Key("time dilation"),
-		Scalar{Type: Real, Data: []byte("0.9878624")},
-		MapEnd{},
-		Key("array example"),
-		ArrayStart{},
-		Scalar{Type: Real, Data: []byte("100.1")},
-		Scalar{Type: Real},
-		ArrayEnd{},
-		Key("binary examples"),
-		MapStart{},
-		Key("empty binary"),
-		Scalar{Type: Binary},
-		Key("base16"),
-		Scalar{Type: Binary, Data: []byte("42696e6172792064617461"), Attr: map[string]string{"encoding": "base16"}},
-		Key("base64"),
-		Scalar{Type: Binary, Data: []byte("QmluYXJ5IGRhdGE="), Attr: map[string]string{"encoding": "base64"}},
-		Key("base85"),
-		Scalar{Type: Binary, Data: []byte("6>:=GEd8d<@<>o"), Attr: map[string]string{"encoding": "base85"}},
-		MapEnd{},
-		MapEnd{},
-	}
 	scanner := NewXMLScanner(strings.NewReader(xmlStr))
-	testScan(t, scanner, expected)
+	testScan(t, scanner, xmlStrTokens)
 }
 
 func TestXMLUnmarshalScalar(t *testing.T) {
@@ -506,3 +486,1323 @@ func TestXMLUnmarshalMap(t *testing.T) {
 		t.Fatalf("Expected dst3[b] to equal \"b\" but got %s", dst3["b"])
 	}
 }
+
+func TestXMLUnmarshalDateUnit(t *testing.T) {
+	var dst struct {
+		Seconds time.Time
+		Millis  time.Time
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <map>
+	  	<key>Seconds</key><integer>1136214245</integer>
+	  	<key>Millis</key><real>1136214245123</real>
+	  </map>
+	</llsd>`
+	err := UnmarshalXML([]byte(xml), &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Seconds.Unix() != 1136214245 {
+		t.Fatalf("Expected dst.Seconds to equal \"%d\" got \"%d\"", 1136214245, dst.Seconds.Unix())
+	}
+
+	dec := NewXMLDecoder(strings.NewReader(xml))
+	dec.DateUnit = Milliseconds
+	if err := dec.Unmarshal(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Millis.UnixMilli() != 1136214245123 {
+		t.Fatalf("Expected dst.Millis to equal \"%d\" got \"%d\"", 1136214245123, dst.Millis.UnixMilli())
+	}
+}
+
+func TestXMLUnmarshalDateContainer(t *testing.T) {
+	var dst struct {
+		Date time.Time
+	}
+	for _, c := range []struct {
+		value string
+		err   string
+	}{
+		{`<map><key>a</key><integer>1</integer></map>`, "Cannot unmarshal map into Go struct field Date"},
+		{`<array><integer>1</integer></array>`, "Cannot unmarshal array into Go struct field Date"},
+	} {
+		xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>Date</key>` + c.value + `</map></llsd>`
+		err := UnmarshalXML([]byte(xml), &dst)
+		var typeErr *UnmarshalTypeError
+		if !errors.As(err, &typeErr) || !errorContains(err, c.err) {
+			t.Fatalf("%s: expected %q but got %v", c.value, c.err, err)
+		}
+	}
+}
+
+func TestXMLFieldTransform(t *testing.T) {
+	var dst struct {
+		A      string
+		Object struct {
+			B string
+		}
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <map>
+	  	<key>A</key><string>  a </string>
+		<key>Object</key>
+		<map>
+		  <key>B</key><string> b</string>
+		</map>
+	  </map>
+	</llsd>`
+	var paths []string
+	dec := NewXMLDecoder(strings.NewReader(xml))
+	dec.FieldTransform = func(path string, v reflect.Value) error {
+		paths = append(paths, path)
+		if v.Kind() == reflect.String {
+			v.SetString(strings.TrimSpace(v.String()))
+		}
+		return nil
+	}
+	if err := dec.Unmarshal(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.A != "a" {
+		t.Fatalf("Expected dst.A to equal \"a\" but got \"%s\"", dst.A)
+	}
+	if dst.Object.B != "b" {
+		t.Fatalf("Expected dst.Object.B to equal \"b\" but got \"%s\"", dst.Object.B)
+	}
+	if strings.Join(paths, ",") != "A,Object.B,Object" {
+		t.Fatalf("Expected transform paths \"A,Object.B,Object\" but got \"%s\"", strings.Join(paths, ","))
+	}
+}
+
+func TestXMLUnmarshalSelfClosingContainers(t *testing.T) {
+	var dst struct {
+		Slice []string
+		Map   map[string]string
+		Ptr   *struct{ A string }
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <map>
+	  	<key>Slice</key><array/>
+	  	<key>Map</key><map/>
+	  	<key>Ptr</key><map/>
+	  </map>
+	</llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Slice == nil || len(dst.Slice) != 0 {
+		t.Fatalf("Expected dst.Slice to be empty but got %v", dst.Slice)
+	}
+	if dst.Map == nil || len(dst.Map) != 0 {
+		t.Fatalf("Expected dst.Map to be empty but got %v", dst.Map)
+	}
+	if dst.Ptr == nil {
+		t.Fatalf("Expected dst.Ptr to be initialized")
+	}
+
+	var root struct{ A string }
+	if err := UnmarshalXML([]byte(`<llsd><map/></llsd>`), &root); err != nil {
+		t.Fatal(err)
+	}
+	var slice []string
+	if err := UnmarshalXML([]byte(`<llsd><array/></llsd>`), &slice); err != nil {
+		t.Fatal(err)
+	}
+	if slice == nil {
+		t.Fatalf("Expected slice to be empty but got nil")
+	}
+}
+
+func TestXMLUnmarshalContainerIntoScalar(t *testing.T) {
+	var dst struct {
+		Object struct {
+			A string
+			B int
+		}
+	}
+	for _, c := range []struct {
+		value    string
+		expected string
+	}{
+		{"<key>A</key><map><key>a</key><string>a</string></map>", "LLSD: Cannot unmarshal map into Go struct field Object.A of type string."},
+		{"<key>B</key><array><integer>1</integer></array>", "LLSD: Cannot unmarshal array into Go struct field Object.B of type int."},
+	} {
+		xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>Object</key><map>` + c.value + `</map></map></llsd>`
+		err := UnmarshalXML([]byte(xml), &dst)
+		if err == nil || err.Error() != c.expected {
+			t.Fatalf("Expected error \"%s\" but got \"%v\"", c.expected, err)
+		}
+	}
+}
+
+func TestXMLUnmarshalDateMode(t *testing.T) {
+	const ts = "2006-02-01T14:29:53.5Z"
+	date, _ := time.Parse(time.RFC3339, ts)
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>Date</key><date>` + ts + `</date></map></llsd>`
+	for _, c := range []struct {
+		mode     DateMode
+		expected any
+	}{
+		{AsTime, date},
+		{AsEpoch, 1138804193.5},
+		{AsString, ts},
+	} {
+		var dst struct{ Date any }
+		dec := NewXMLDecoder(strings.NewReader(xml))
+		dec.DateMode = c.mode
+		if err := dec.Unmarshal(&dst); err != nil {
+			t.Fatal(err)
+		}
+		if dst.Date != c.expected {
+			t.Fatalf("Expected dst.Date to equal \"%v\" but got \"%v\"", c.expected, dst.Date)
+		}
+	}
+}
+
+func TestXMLUnmarshalAttrs(t *testing.T) {
+	var dst struct {
+		Value      string            `llsd:"value"`
+		ValueAttrs map[string]string `llsd:"value,attrs"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <map>
+	  	<key>value</key><string foo="bar">x</string>
+	  </map>
+	</llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Value != "x" {
+		t.Fatalf("Expected dst.Value to equal \"x\" but got \"%s\"", dst.Value)
+	}
+	if len(dst.ValueAttrs) != 1 || dst.ValueAttrs["foo"] != "bar" {
+		t.Fatalf("Expected dst.ValueAttrs to equal {\"foo\": \"bar\"} but got %v", dst.ValueAttrs)
+	}
+}
+
+func TestXMLScanNilAttr(t *testing.T) {
+	scanner := NewXMLScanner(strings.NewReader(`<llsd><string>a</string></llsd>`))
+	tok, err := scanner.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.(Scalar).Attr != nil {
+		t.Fatalf("Expected scalar without attributes to have nil Attr, got %v", tok.(Scalar).Attr)
+	}
+}
+
+func TestXMLUnmarshalCommaDecimal(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><real>1,5</real></llsd>`
+	var dst float64
+	if err := UnmarshalXML([]byte(xml), &dst); err == nil {
+		t.Fatalf("Expected comma decimal to be rejected by default")
+	}
+	dec := NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{AcceptCommaDecimal: true})
+	if err := dec.Unmarshal(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst != 1.5 {
+		t.Fatalf("Expected dst to equal \"1.5\" but got \"%f\"", dst)
+	}
+}
+
+func TestXMLScanCharDataAndCDATA(t *testing.T) {
+	xml := `<llsd><array><string>a &amp; b<![CDATA[ c ]]></string><key>k<!-- comment -->ey</key></array></llsd>`
+	expected := []Token{
+		ArrayStart{},
+		Scalar{Type: String, Data: []byte("a & b c ")},
+		Key("key"),
+		ArrayEnd{},
+	}
+	testScan(t, NewXMLScanner(strings.NewReader(xml)), expected)
+}
+
+func TestXMLUnmarshalNestedMaps(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <map>
+	  	<key>a</key>
+		<map>
+		  <key>b</key><integer>1</integer>
+		  <key>c</key><integer>2</integer>
+		</map>
+	  </map>
+	</llsd>`
+	var dst map[string]map[string]int
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst["a"]["b"] != 1 || dst["a"]["c"] != 2 {
+		t.Fatalf("Expected dst[a] to equal map[b:1 c:2] but got %v", dst["a"])
+	}
+
+	xml = `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <map>
+	  	<key>a</key>
+		<array><string>b</string><string>c</string></array>
+	  </map>
+	</llsd>`
+	var dst2 map[string][]string
+	if err := UnmarshalXML([]byte(xml), &dst2); err != nil {
+		t.Fatal(err)
+	}
+	if len(dst2["a"]) != 2 || dst2["a"][0] != "b" || dst2["a"][1] != "c" {
+		t.Fatalf("Expected dst2[a] to equal [b c] but got %v", dst2["a"])
+	}
+}
+
+func TestXMLUnmarshalFallback(t *testing.T) {
+	type T struct {
+		A     string
+		Other any `llsd:",fallback"`
+	}
+	var dst T
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><string>error</string></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Other != "error" {
+		t.Fatalf("Expected dst.Other to equal \"error\" but got \"%v\"", dst.Other)
+	}
+
+	dst = T{}
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><array><integer>1</integer><string>a</string></array></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if other, ok := dst.Other.([]any); !ok || len(other) != 2 || other[0] != int32(1) || other[1] != "a" {
+		t.Fatalf("Expected dst.Other to equal [1 a] but got \"%v\"", dst.Other)
+	}
+
+	dst = T{}
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>A</key><string>a</string></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.A != "a" || dst.Other != nil {
+		t.Fatalf("Expected map to decode into fields, got %v", dst)
+	}
+}
+
+func TestXMLUnmarshalStrictTypes(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><binary encoding="base16">0000002A</binary></llsd>`
+	var dst int32
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst != 42 {
+		t.Fatalf("Expected dst to equal 42 but got %d", dst)
+	}
+
+	dec := NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{StrictTypes: true})
+	err := dec.Unmarshal(&dst)
+	if _, ok := err.(*UnmarshalTypeError); !ok {
+		t.Fatalf("Expected UnmarshalTypeError but got %v", err)
+	}
+
+	// Conversions into matching types are unaffected
+	var b []byte
+	dec = NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{StrictTypes: true})
+	if err := dec.Unmarshal(&b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestXMLUnmarshalRest(t *testing.T) {
+	var dst struct {
+		Name  string
+		Count int
+		Rest  []any `llsd:",rest"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <array>
+	    <string>x</string>
+	    <integer>2</integer>
+	    <string>a</string>
+	    <array><integer>1</integer></array>
+	    <integer>3</integer>
+	  </array>
+	</llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Name != "x" || dst.Count != 2 {
+		t.Fatalf("Expected positional fields to equal \"x\", 2 but got %q, %d", dst.Name, dst.Count)
+	}
+	expected := []any{"a", []any{int32(1)}, int32(3)}
+	if !reflect.DeepEqual(dst.Rest, expected) {
+		t.Fatalf("Expected dst.Rest to equal %v but got %v", expected, dst.Rest)
+	}
+}
+
+func TestXMLUnmarshalNumeric(t *testing.T) {
+	var dst struct {
+		Count int     `llsd:"count,numeric"`
+		Scale float64 `llsd:"scale,numeric"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>count</key><real>3.0</real><key>scale</key><integer>2</integer></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Count != 3 || dst.Scale != 2 {
+		t.Fatalf("Expected dst to equal {3, 2} but got %v", dst)
+	}
+
+	// Fractional reals are not truncated
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>count</key><real>3.5</real></map></llsd>`
+	if _, ok := UnmarshalXML([]byte(xml), &dst).(*UnmarshalTypeError); !ok {
+		t.Fatal("Expected UnmarshalTypeError decoding 3.5 into int")
+	}
+
+	// Untagged fields remain strict
+	var untagged struct{ Scale float64 }
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>Scale</key><integer>2</integer></map></llsd>`
+	if _, ok := UnmarshalXML([]byte(xml), &untagged).(*UnmarshalTypeError); !ok {
+		t.Fatal("Expected UnmarshalTypeError decoding integer into untagged float64")
+	}
+}
+
+func TestXMLUnmarshalBinaryTagEncoding(t *testing.T) {
+	var dst struct {
+		Data []byte `llsd:"data,base64"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>data</key><binary>QmluYXJ5IGRhdGE=</binary></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if string(dst.Data) != "Binary data" {
+		t.Fatalf("Expected dst.Data to equal \"Binary data\" but got %q", dst.Data)
+	}
+
+	// An encoding attribute takes precedence over the tag
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>data</key><binary encoding="base16">42696E61727920646174610A</binary></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if string(dst.Data) != "Binary data\n" {
+		t.Fatalf("Expected dst.Data to equal \"Binary data\\n\" but got %q", dst.Data)
+	}
+}
+
+func TestXMLUnmarshalArrayFill(t *testing.T) {
+	var dst struct {
+		Values [5]int `llsd:"values"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>values</key><array><integer>1</integer><integer>2</integer></array></map></llsd>`
+	filled := map[string]int{}
+	dec := NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{
+		ArrayFill: func(path string, n int) { filled[path] = n },
+	})
+	if err := dec.Unmarshal(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if filled["values"] != 2 {
+		t.Fatalf("Expected 2 elements filled but got %v", filled)
+	}
+	if dst.Values != [5]int{1, 2} {
+		t.Fatalf("Expected dst.Values to equal [1 2 0 0 0] but got %v", dst.Values)
+	}
+}
+
+// Tag options of container fields do not affect the decoding of their contents
+func TestXMLUnmarshalTaggedContainers(t *testing.T) {
+	type item struct {
+		Name string `llsd:"name"`
+	}
+	var dst struct {
+		Items  []item           `llsd:"items,omitempty,base64"`
+		Lookup map[string]int   `llsd:"lookup,numeric"`
+		Nested *struct{ A int } `llsd:"nested,real"`
+		Pairs  map[string]int   `llsd:"pairs,pairs,base64"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <map>
+	    <key>items</key><array><map><key>name</key><string>a</string></map></array>
+	    <key>lookup</key><map><key>x</key><integer>1</integer></map>
+	    <key>nested</key><map><key>A</key><integer>2</integer></map>
+	    <key>pairs</key><array><array><string>y</string><integer>3</integer></array></array>
+	  </map>
+	</llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if len(dst.Items) != 1 || dst.Items[0].Name != "a" {
+		t.Fatalf("Expected dst.Items to equal [{a}] but got %v", dst.Items)
+	}
+	if dst.Lookup["x"] != 1 {
+		t.Fatalf("Expected dst.Lookup to equal map[x:1] but got %v", dst.Lookup)
+	}
+	if dst.Nested == nil || dst.Nested.A != 2 {
+		t.Fatalf("Expected dst.Nested to equal &{2} but got %v", dst.Nested)
+	}
+	if dst.Pairs["y"] != 3 {
+		t.Fatalf("Expected dst.Pairs to equal map[y:3] but got %v", dst.Pairs)
+	}
+}
+
+func TestXMLUnmarshalAnySliceHint(t *testing.T) {
+	type item struct {
+		Name string `llsd:"name"`
+	}
+	var dst struct {
+		Items any `llsd:"items"`
+	}
+	dst.Items = []item{}
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <map>
+	    <key>items</key><array><map><key>name</key><string>a</string></map><map><key>name</key><string>b</string></map></array>
+	  </map>
+	</llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	items, ok := dst.Items.([]item)
+	if !ok {
+		t.Fatalf("Expected dst.Items to hold []item but got %T", dst.Items)
+	}
+	if len(items) != 2 || items[0].Name != "a" || items[1].Name != "b" {
+		t.Fatalf("Expected dst.Items to equal [{a} {b}] but got %v", items)
+	}
+}
+
+func TestXMLUnmarshalCollectErrors(t *testing.T) {
+	type region struct {
+		Name string `llsd:"name"`
+		X    int    `llsd:"x"`
+	}
+	var dst []region
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <array>
+	    <map><key>name</key><string>a</string><key>x</key><integer>1</integer></map>
+	    <map><key>name</key><map><key>bad</key><string>b</string></map><key>x</key><integer>2</integer></map>
+	    <map><key>name</key><string>c</string><key>x</key><integer>3</integer></map>
+	  </array>
+	</llsd>`
+	dec := NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{CollectErrors: true})
+	err := dec.Unmarshal(&dst)
+	errs, ok := err.(UnmarshalTypeErrors)
+	if !ok {
+		t.Fatalf("Expected UnmarshalTypeErrors but got %v", err)
+	}
+	if len(errs) != 1 || errs[0].Field != "name" {
+		t.Fatalf("Expected one error for field name but got %v", errs)
+	}
+	expected := []region{{"a", 1}, {"", 2}, {"c", 3}}
+	if !reflect.DeepEqual(dst, expected) {
+		t.Fatalf("Expected dst to equal %v but got %v", expected, dst)
+	}
+
+	// A container element in place of a scalar is skipped entirely
+	var ints []int
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><array><integer>1</integer><array><integer>9</integer></array><integer>3</integer></array></llsd>`
+	dec = NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{CollectErrors: true})
+	if errs, ok := dec.Unmarshal(&ints).(UnmarshalTypeErrors); !ok || len(errs) != 1 {
+		t.Fatalf("Expected one collected error but got %v", errs)
+	}
+	if !reflect.DeepEqual(ints, []int{1, 0, 3}) {
+		t.Fatalf("Expected ints to equal [1 0 3] but got %v", ints)
+	}
+}
+
+func TestXMLMaxDecodedBytes(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><array>` + strings.Repeat("<string>abcdefgh</string>", 1000) + `</array></llsd>`
+	var dst []string
+	dec := NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{MaxDecodedBytes: 4096})
+	err := dec.Unmarshal(&dst)
+	if !errorContains(err, "Invalid LLSD: document exceeds 4096 bytes of data") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dec = NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{MaxDecodedBytes: 8000})
+	if err := dec.Unmarshal(&dst); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestXMLScanBOM(t *testing.T) {
+	plain := NewXMLScanner(strings.NewReader(xmlStr))
+	if _, err := plain.Token(); err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range []string{"\ufeff", "\ufeff\n", "\n  "} {
+		scanner := NewXMLScanner(strings.NewReader(prefix + xmlStr))
+		tok, err := scanner.Token()
+		if err != nil {
+			t.Fatalf("%q: %v", prefix, err)
+		}
+		if _, ok := tok.(MapStart); !ok {
+			t.Fatalf("%q: Expected first token to be MapStart but got %v", prefix, tok)
+		}
+		// Offsets count the prefix bytes of the input
+		if expected := plain.Offset() + int64(len(prefix)); scanner.Offset() != expected {
+			t.Fatalf("%q: Expected offset %d but got %d", prefix, expected, scanner.Offset())
+		}
+
+		var dst struct {
+			Scale string `llsd:"scale"`
+		}
+		if err := UnmarshalXML([]byte(prefix+xmlStr), &dst); err != nil {
+			t.Fatalf("%q: %v", prefix, err)
+		}
+		if dst.Scale != "one minute" {
+			t.Fatalf("%q: Expected dst.Scale to equal \"one minute\" but got %q", prefix, dst.Scale)
+		}
+	}
+}
+
+func TestXMLUnmarshalLenientInteger(t *testing.T) {
+	for _, c := range []struct {
+		xml      string
+		strict   bool
+		expected int
+		err      string
+	}{
+		{xml: "<integer>42</integer>", expected: 42},
+		{xml: "<integer>42.0</integer>", expected: 42},
+		{xml: "<integer>-42.00</integer>", expected: -42},
+		{xml: "<integer>42.5</integer>", err: "invalid syntax"},
+		{xml: "<integer>42.0</integer>", strict: true, err: "invalid syntax"},
+		{xml: "<real>42</real>", expected: 42},
+		{xml: "<integer>0x1F</integer>", expected: 31},
+		{xml: "<integer>-0x1f</integer>", expected: -31},
+		{xml: "<integer>0xZZ</integer>", err: `Invalid hexadecimal integer "0xZZ"`},
+		{xml: "<integer>0x1F</integer>", strict: true, err: `Integer "0x1F" is not decimal`},
+	} {
+		var dst struct {
+			Value int `llsd:"value,numeric"`
+		}
+		xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>value</key>` + c.xml + `</map></llsd>`
+		dec := NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{StrictTypes: c.strict})
+		err := dec.Unmarshal(&dst)
+		if !errorContains(err, c.err) {
+			t.Fatalf("%s: unexpected error: %v", c.xml, err)
+		}
+		if err == nil && dst.Value != c.expected {
+			t.Fatalf("%s: Expected %d but got %d", c.xml, c.expected, dst.Value)
+		}
+	}
+}
+
+func TestTeeTokenReader(t *testing.T) {
+	var recorded []Token
+	r := TeeTokenReader(NewXMLScanner(strings.NewReader(xmlStr)), func(tok Token) {
+		recorded = append(recorded, tok)
+	})
+	var dst map[string]any
+	if err := NewDecoder(r, FormatXML, DecoderOptions{}).Unmarshal(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst["scale"] != "one minute" {
+		t.Fatalf("Expected dst[\"scale\"] to equal \"one minute\" but got %v", dst["scale"])
+	}
+	if len(recorded) != len(xmlStrTokens) {
+		t.Fatalf("Expected %d tokens to be recorded but got %d", len(xmlStrTokens), len(recorded))
+	}
+	testScan(t, &mockTokenReader{tokens: recorded}, xmlStrTokens)
+}
+
+func TestXMLUnmarshalPointerContainers(t *testing.T) {
+	var dst struct {
+		Names  *[]string       `llsd:"names"`
+		Counts *map[string]int `llsd:"counts"`
+		Empty  *[]string       `llsd:"empty"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <map>
+	    <key>names</key><array><string>a</string><string>b</string></array>
+	    <key>counts</key><map><key>x</key><integer>1</integer></map>
+	    <key>empty</key><array />
+	  </map>
+	</llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Names == nil || !reflect.DeepEqual(*dst.Names, []string{"a", "b"}) {
+		t.Fatalf("Expected dst.Names to point to [a b] but got %v", dst.Names)
+	}
+	if dst.Counts == nil || !reflect.DeepEqual(*dst.Counts, map[string]int{"x": 1}) {
+		t.Fatalf("Expected dst.Counts to point to map[x:1] but got %v", dst.Counts)
+	}
+	if dst.Empty == nil || *dst.Empty == nil || len(*dst.Empty) != 0 {
+		t.Fatalf("Expected dst.Empty to point to an empty slice but got %v", dst.Empty)
+	}
+}
+
+func TestXMLDecodeArray(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<llsd>
+	  <array>
+	    <map><key>name</key><string>a</string><key>count</key><integer>1</integer></map>
+	    <map><key>name</key><string>b</string><key>count</key><integer>2</integer></map>
+	    <map><key>name</key><string>c</string><key>count</key><integer>3</integer></map>
+	  </array>
+	</llsd>`
+	var record struct {
+		Name  string `llsd:"name"`
+		Count int    `llsd:"count"`
+	}
+	sum, calls := 0, 0
+	err := NewXMLDecoder(strings.NewReader(xml)).DecodeArray(func(decode func(v any) error) error {
+		calls++
+		if err := decode(&record); err != nil {
+			return err
+		}
+		sum += record.Count
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || sum != 6 {
+		t.Fatalf("Expected 3 calls summing to 6 but got %d calls summing to %d", calls, sum)
+	}
+
+	// Elements which are not decoded are skipped
+	calls = 0
+	err = NewXMLDecoder(strings.NewReader(xml)).DecodeArray(func(decode func(v any) error) error {
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("Expected 3 calls but got %d", calls)
+	}
+}
+
+func TestXMLUnmarshalDecodeError(t *testing.T) {
+	var dst struct {
+		A     int `llsd:"a"`
+		Inner struct {
+			B int `llsd:"b"`
+		} `llsd:"inner"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>a</key><integer>1</integer><key>inner</key><map><key>b</key><integer>abc</integer></map></map></llsd>`
+	err := UnmarshalXML([]byte(xml), &dst)
+	decodeErr, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatalf("Expected DecodeError but got %v", err)
+	}
+	if decodeErr.Key != "inner.b" {
+		t.Fatalf("Expected DecodeError to name key \"inner.b\" but got %q", decodeErr.Key)
+	}
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatalf("Expected DecodeError to wrap strconv.ErrSyntax but got %v", decodeErr.Err)
+	}
+
+	// Type errors of maps name the key
+	var m map[string]int
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>a</key><string>x</string></map></llsd>`
+	err = UnmarshalXML([]byte(xml), &m)
+	if decodeErr, ok := err.(*DecodeError); !ok || decodeErr.Key != "a" {
+		t.Fatalf("Expected DecodeError naming key \"a\" but got %v", err)
+	}
+}
+
+func TestXMLUnmarshalRawMessage(t *testing.T) {
+	type envelope struct {
+		Type string     `llsd:"type"`
+		Body RawMessage `llsd:"body"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>type</key><string>point</string><key>body</key><map><key>x</key><integer>1</integer><key>y</key><binary encoding="base64">AQI=</binary></map></map></llsd>`
+	var env envelope
+	if err := UnmarshalXML([]byte(xml), &env); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<map><key>x</key><integer>1</integer><key>y</key><binary encoding="base64">AQI=</binary></map>`
+	if string(env.Body) != expected {
+		t.Fatalf("Expected body %s but got %s", expected, env.Body)
+	}
+
+	// Raw message is decoded separately once its type is known
+	var point struct {
+		X int    `llsd:"x"`
+		Y []byte `llsd:"y"`
+	}
+	if err := UnmarshalXML(env.Body, &point); err != nil {
+		t.Fatal(err)
+	}
+	if point.X != 1 || !bytes.Equal(point.Y, []byte{1, 2}) {
+		t.Fatalf("Expected point {1 [1 2]} but got %v", point)
+	}
+
+	// Raw message is written verbatim
+	b, err := MarshalXML(&env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "<key>body</key>"+expected) {
+		t.Fatalf("Expected %s to contain body %s", b, expected)
+	}
+
+	// Values of binary LLSD are captured in text form
+	bin := []byte("{\x00\x00\x00\x01k\x00\x00\x00\x04body[\x00\x00\x00\x01i\x00\x00\x00\x2a]}")
+	env = envelope{}
+	if err := UnmarshalBinary(bin, &env); err != nil {
+		t.Fatal(err)
+	}
+	if string(env.Body) != "<array><integer>42</integer></array>" {
+		t.Fatalf("Expected body <array><integer>42</integer></array> but got %s", env.Body)
+	}
+}
+
+func TestXMLUnmarshalExtras(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>name</key><string>a</string><key>id</key><uuid>67153d5b-3659-afb4-8510-adda2c034649</uuid><key>nested</key><map><key>x</key><integer>1</integer></map></map></llsd>`
+	id := UUID{0x67, 0x15, 0x3d, 0x5b, 0x36, 0x59, 0xaf, 0xb4, 0x85, 0x10, 0xad, 0xda, 0x2c, 0x03, 0x46, 0x49}
+
+	// Extras of any keep their LLSD types
+	var typed struct {
+		Name   string         `llsd:"name"`
+		Extras map[string]any `llsd:",extras"`
+	}
+	if err := UnmarshalXML([]byte(xml), &typed); err != nil {
+		t.Fatal(err)
+	}
+	if typed.Name != "a" || len(typed.Extras) != 2 {
+		t.Fatalf("Expected name and two extras but got %v", typed)
+	}
+	if typed.Extras["id"] != id {
+		t.Fatalf("Expected extras[\"id\"] to be UUID %v but got %#v", id, typed.Extras["id"])
+	}
+	if nested, ok := typed.Extras["nested"].(map[string]any); !ok || nested["x"] != int32(1) {
+		t.Fatalf("Expected extras[\"nested\"] to be a map but got %#v", typed.Extras["nested"])
+	}
+
+	// Extras are written as keys of the struct, sorted among its fields
+	var out bytes.Buffer
+	if err := NewXMLEncoderWith(&out, EncoderOptions{SortKeys: true}).Encode(&typed); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<map><key>id</key><uuid>67153d5b3659afb48510adda2c034649</uuid><key>name</key><string>a</string><key>nested</key><map><key>x</key><integer>1</integer></map></map>`
+	if !strings.Contains(out.String(), expected) {
+		t.Fatalf("Expected %s, got %s", expected, out.String())
+	}
+
+	// Extras of RawMessage are captured undecoded
+	var raw struct {
+		Name   string                `llsd:"name"`
+		Extras map[string]RawMessage `llsd:",extras"`
+	}
+	if err := UnmarshalXML([]byte(xml), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if string(raw.Extras["nested"]) != "<map><key>x</key><integer>1</integer></map>" {
+		t.Fatalf("Expected raw nested map but got %s", raw.Extras["nested"])
+	}
+
+	// Without extras, unknown maps are skipped along with their keys
+	var skipped struct {
+		X int `llsd:"x"`
+	}
+	if err := UnmarshalXML([]byte(xml), &skipped); err != nil {
+		t.Fatal(err)
+	}
+	if skipped.X != 0 {
+		t.Fatalf("Expected key of unknown map to be skipped but got x = %d", skipped.X)
+	}
+}
+
+func TestXMLUnmarshalBooleanNumeric(t *testing.T) {
+	var dst struct {
+		Int   int     `llsd:"int"`
+		Uint  uint8   `llsd:"uint"`
+		Real  float64 `llsd:"real"`
+		False int     `llsd:"false"`
+	}
+	dst.False = 7
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>int</key><boolean>true</boolean><key>uint</key><boolean>1</boolean><key>real</key><boolean>true</boolean><key>false</key><boolean>0</boolean></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Int != 1 || dst.Uint != 1 || dst.Real != 1 || dst.False != 0 {
+		t.Fatalf("Expected {1 1 1 0} but got %v", dst)
+	}
+
+	dec := NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{StrictTypes: true})
+	if _, ok := dec.Unmarshal(&dst).(*UnmarshalTypeError); !ok {
+		t.Fatal("Expected UnmarshalTypeError decoding boolean into int with StrictTypes")
+	}
+}
+
+func TestXMLUnmarshalFlatStruct(t *testing.T) {
+	type flat struct {
+		String  string  `llsd:"string"`
+		Int     int     `llsd:"int"`
+		Int8    int8    `llsd:"int8"`
+		Float32 float32 `llsd:"float32"`
+		Float64 float64 `llsd:"float64"`
+		Bool    bool    `llsd:"bool"`
+		Numeric int     `llsd:"numeric,numeric"`
+		Convert int     `llsd:"convert"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map>
+	<key>string</key><string>a</string>
+	<key>int</key><integer>-42</integer>
+	<key>int8</key><integer>7</integer>
+	<key>float32</key><real>1.5</real>
+	<key>float64</key><real>0.25</real>
+	<key>bool</key><boolean>true</boolean>
+	<key>numeric</key><real>3.0</real>
+	<key>convert</key><boolean>true</boolean>
+	</map></llsd>`
+	expected := flat{"a", -42, 7, 1.5, 0.25, true, 3, 1}
+
+	// Direct assignment to basic fields matches the general path, which is
+	// taken when collecting errors
+	for _, collect := range []bool{false, true} {
+		var dst flat
+		dec := NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{CollectErrors: collect})
+		if err := dec.Unmarshal(&dst); err != nil {
+			t.Fatal(err)
+		}
+		if dst != expected {
+			t.Fatalf("Expected %v but got %v (CollectErrors: %t)", expected, dst, collect)
+		}
+	}
+
+	// Overflow is still reported
+	var dst flat
+	overflow := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>int8</key><integer>300</integer></map></llsd>`
+	if _, ok := UnmarshalXML([]byte(overflow), &dst).(*UnmarshalTypeError); !ok {
+		t.Fatal("Expected UnmarshalTypeError decoding 300 into int8")
+	}
+}
+
+func TestXMLUnmarshalSingletonArray(t *testing.T) {
+	var dst struct {
+		Name string `llsd:"name"`
+	}
+	for _, c := range []struct {
+		value string
+		err   string
+	}{
+		{value: "<array><string>x</string></array>"},
+		{value: "<array><string>x</string><string>y</string></array>", err: "Cannot unmarshal array of more than one element into Go struct field name"},
+		{value: "<array></array>", err: "Cannot unmarshal empty array into Go struct field name"},
+	} {
+		dst.Name = ""
+		xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>name</key>` + c.value + `</map></llsd>`
+		dec := NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{UnwrapSingletonArrays: true})
+		err := dec.Unmarshal(&dst)
+		if !errorContains(err, c.err) {
+			t.Fatalf("%s: unexpected error: %v", c.value, err)
+		}
+		if err == nil && dst.Name != "x" {
+			t.Fatalf("%s: Expected name \"x\" but got %q", c.value, dst.Name)
+		}
+	}
+
+	// Arrays are rejected by default
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>name</key><array><string>x</string></array></map></llsd>`
+	if _, ok := UnmarshalXML([]byte(xml), &dst).(*UnmarshalTypeError); !ok {
+		t.Fatal("Expected UnmarshalTypeError decoding array into string")
+	}
+}
+
+func TestXMLUnmarshalSQLNull(t *testing.T) {
+	var dst struct {
+		Name  sql.NullString  `llsd:"name"`
+		Count sql.NullInt64   `llsd:"count"`
+		Scale *sql.NullString `llsd:"scale"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>name</key><string>a</string><key>count</key><integer>3</integer><key>scale</key><string>one minute</string></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if !dst.Name.Valid || dst.Name.String != "a" || !dst.Count.Valid || dst.Count.Int64 != 3 {
+		t.Fatalf("Expected valid name \"a\" and count 3 but got %v, %v", dst.Name, dst.Count)
+	}
+	if dst.Scale == nil || !dst.Scale.Valid || dst.Scale.String != "one minute" {
+		t.Fatalf("Expected valid scale \"one minute\" but got %v", dst.Scale)
+	}
+
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>name</key><undef /><key>count</key><undef /></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Name.Valid || dst.Count.Valid {
+		t.Fatalf("Expected undef to decode as NULL but got %v, %v", dst.Name, dst.Count)
+	}
+}
+
+func TestXMLUnmarshalDuplicateKeys(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>a</key><integer>1</integer><key>a</key><array><integer>2</integer></array><key>b</key><integer>3</integer></map></llsd>`
+	for _, c := range []struct {
+		policy   DuplicateKeyPolicy
+		expected any
+		err      string
+	}{
+		{policy: LastWins, expected: []any{int32(2)}},
+		{policy: FirstWins, expected: int32(1)},
+		{policy: DuplicateError, err: `Invalid LLSD: duplicate key "a"`},
+	} {
+		var m map[string]any
+		dec := NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{DuplicateKeys: c.policy})
+		err := dec.Unmarshal(&m)
+		if !errorContains(err, c.err) {
+			t.Fatalf("%d: unexpected error: %v", c.policy, err)
+		}
+		if err == nil && (!reflect.DeepEqual(m["a"], c.expected) || m["b"] != int32(3)) {
+			t.Fatalf("%d: Expected a = %v, b = 3 but got %v", c.policy, c.expected, m)
+		}
+
+		var s struct {
+			A any   `llsd:"a"`
+			B int32 `llsd:"b"`
+		}
+		dec = NewXMLDecoderWith(strings.NewReader(xml), DecoderOptions{DuplicateKeys: c.policy})
+		err = dec.Unmarshal(&s)
+		if !errorContains(err, c.err) {
+			t.Fatalf("%d: unexpected error: %v", c.policy, err)
+		}
+		if err == nil && (!reflect.DeepEqual(s.A, c.expected) || s.B != 3) {
+			t.Fatalf("%d: Expected a = %v, b = 3 but got %v", c.policy, c.expected, s)
+		}
+	}
+}
+
+type langString struct {
+	Text string
+	Lang string
+}
+
+func (s *langString) UnmarshalLLSDAttrs(attrs map[string]string) error {
+	s.Lang = attrs["lang"]
+	return nil
+}
+
+func (s *langString) UnmarshalTextLLSD(b []byte) error {
+	s.Text = string(b)
+	return nil
+}
+
+func TestXMLUnmarshalAttrUnmarshaler(t *testing.T) {
+	var dst struct {
+		Greeting langString `llsd:"greeting"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>greeting</key><string lang="en">hello</string></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	expected := langString{Text: "hello", Lang: "en"}
+	if dst.Greeting != expected {
+		t.Fatalf("Expected %v but got %v", expected, dst.Greeting)
+	}
+}
+
+func TestXMLUnmarshalWrappedBinary(t *testing.T) {
+	var dst []byte
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+<llsd>
+  <binary encoding="base64">
+    QmluYXJ5
+    IGRhdGE=
+  </binary>
+</llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if string(dst) != "Binary data" {
+		t.Fatalf("Expected \"Binary data\" but got %q", dst)
+	}
+}
+
+func TestXMLUnmarshalPacked(t *testing.T) {
+	type header struct {
+		A int32
+		B uint32
+		C float32
+	}
+	var dst struct {
+		Header header `llsd:"header,packed"`
+	}
+	// 12 bytes: -2, 7, 1.5
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>header</key><binary>FFFFFFFE000000073FC00000</binary></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	expected := header{A: -2, B: 7, C: 1.5}
+	if dst.Header != expected {
+		t.Fatalf("Expected %v but got %v", expected, dst.Header)
+	}
+
+	b, err := MarshalXML(&dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "<binary>FFFFFFFE000000073FC00000</binary>") {
+		t.Fatalf("Expected packed binary, got %s", b)
+	}
+
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>header</key><binary>FFFFFFFE</binary></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); !errorContains(err, "binary of 4 bytes") {
+		t.Fatalf("Expected short binary to fail but got %v", err)
+	}
+
+	type private struct {
+		A int32
+		b uint32
+	}
+	var unexported struct {
+		Header private `llsd:"header,packed"`
+	}
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>header</key><binary>FFFFFFFE00000007</binary></map></llsd>`
+	var typeErr *UnmarshalTypeError
+	if err := UnmarshalXML([]byte(xml), &unexported); !errors.As(err, &typeErr) {
+		t.Fatalf("Expected unexported field to fail but got %v", err)
+	}
+}
+
+func TestXMLUnmarshalRootArray(t *testing.T) {
+	for _, c := range []struct {
+		xml      string
+		dst      any
+		expected any
+	}{
+		{`<array><integer>1</integer><integer>2</integer></array>`, &[]int{}, &[]int{1, 2}},
+		{`<array><string>a</string><string>b</string></array>`, &[]string{}, &[]string{"a", "b"}},
+		{`<array><binary>6869</binary><binary /></array>`, &[][]byte{}, &[][]byte{[]byte("hi"), {}}},
+		{
+			`<array><map><key>a</key><integer>1</integer></map><map><key>b</key><array><string>c</string></array></map></array>`,
+			&[]map[string]any{},
+			&[]map[string]any{{"a": int32(1)}, {"b": []any{"c"}}},
+		},
+		{`<array><map /><array /></array>`, &[]any{}, &[]any{map[string]any{}, []any{}}},
+	} {
+		xml := `<?xml version="1.0" encoding="UTF-8"?><llsd>` + c.xml + `</llsd>`
+		if err := UnmarshalXML([]byte(xml), c.dst); err != nil {
+			t.Fatalf("%s: %v", c.xml, err)
+		}
+		if !reflect.DeepEqual(c.dst, c.expected) {
+			t.Fatalf("Expected %v but got %v", c.expected, c.dst)
+		}
+	}
+}
+
+func TestXMLUnmarshalReusedSlice(t *testing.T) {
+	// Like encoding/json, existing elements are decoded into and the slice
+	// is truncated to the decoded length
+	dst := []map[string]any{{"x": int32(1)}, {"y": int32(2)}}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><array><map><key>a</key><integer>1</integer></map></array></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]any{{"x": int32(1), "a": int32(1)}}
+	if !reflect.DeepEqual(dst, expected) {
+		t.Fatalf("Expected %v but got %v", expected, dst)
+	}
+
+	// Elements within capacity but beyond the length are not reused
+	ints := []int{1, 2, 3}[:1]
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><array><integer>4</integer><undef /></array></llsd>`
+	if err := UnmarshalXML([]byte(xml), &ints); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ints, []int{4, 0}) {
+		t.Fatalf("Expected [4 0] but got %v", ints)
+	}
+}
+
+// commaDecoder accepts a comma decimal separator in reals.
+type commaDecoder struct {
+	ScalarDecoder
+}
+
+func (d commaDecoder) Real(b []byte) (float64, error) {
+	return d.ScalarDecoder.Real(bytes.Replace(b, []byte(","), []byte("."), 1))
+}
+
+func TestXMLSetScalarDecoder(t *testing.T) {
+	var dst struct {
+		Scale float64 `llsd:"scale"`
+		Count int     `llsd:"count"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>scale</key><real>1,5</real><key>count</key><integer>2</integer></map></llsd>`
+	dec := NewXMLDecoder(strings.NewReader(xml))
+	dec.SetScalarDecoder(commaDecoder{NewTextScalarDecoder()})
+	if err := dec.Unmarshal(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Scale != 1.5 || dst.Count != 2 {
+		t.Fatalf("Expected scale 1.5 and count 2 but got %v, %v", dst.Scale, dst.Count)
+	}
+}
+
+type hookedAgent struct {
+	First string `llsd:"first"`
+	Last  string `llsd:"last"`
+	Name  string `llsd:"-"`
+}
+
+func (a *hookedAgent) AfterUnmarshalLLSD() error {
+	if a.First == "" {
+		return errors.New("missing first name")
+	}
+	a.Name = strings.ToLower(a.First + " " + a.Last)
+	return nil
+}
+
+func TestXMLAfterUnmarshal(t *testing.T) {
+	var dst struct {
+		Agents []hookedAgent `llsd:"agents"`
+		Owner  *hookedAgent  `llsd:"owner"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map>
+<key>agents</key><array><map><key>first</key><string>Ada</string><key>last</key><string>Linden</string></map></array>
+<key>owner</key><map><key>first</key><string>Bo</string><key>last</key><string>Resident</string></map>
+</map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if len(dst.Agents) != 1 || dst.Agents[0].Name != "ada linden" || dst.Owner == nil || dst.Owner.Name != "bo resident" {
+		t.Fatalf("Expected derived names but got %+v, %+v", dst.Agents, dst.Owner)
+	}
+
+	var agent hookedAgent
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>last</key><string>Linden</string></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &agent); !errorContains(err, "missing first name") {
+		t.Fatalf("Expected hook error but got %v", err)
+	}
+}
+
+func TestXMLScanMismatchedClose(t *testing.T) {
+	for _, c := range []struct {
+		xml string
+		err string
+	}{
+		{`<array><integer>1</integer></map>`, "<array> closed by </map>"},
+		{`<map><key>a</key><array></map></map>`, "<array> closed by </map>"},
+		{`<array><integer>1</string></array>`, "<integer> closed by </string>"},
+		{`<array><integer>1</integer>`, "unexpected end of input in <array>"},
+		{`</array>`, "<llsd> closed by </array>"},
+	} {
+		var v any
+		xml := `<?xml version="1.0" encoding="UTF-8"?><llsd>` + c.xml
+		err := UnmarshalXML([]byte(xml), &v)
+		var invalid *InvalidLLSDError
+		if !errors.As(err, &invalid) || !errorContains(err, c.err) {
+			t.Fatalf("%s: expected InvalidLLSDError %q but got %v", c.xml, c.err, err)
+		}
+		if invalid.Offset == 0 {
+			t.Fatalf("%s: expected error offset", c.xml)
+		}
+	}
+}
+
+func TestXMLScanSkip(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><array><map><key>a</key><array><integer>1</integer></array></map><string>b</string></array></llsd>`
+	s := NewXMLScanner(strings.NewReader(xml))
+	for _, expected := range []Token{ArrayStart{}, MapStart{}} {
+		if tok, err := s.Token(); err != nil || !expected.(interface{ Equal(Token) bool }).Equal(tok) {
+			t.Fatalf("Expected %v but got %v, %v", expected, tok, err)
+		}
+	}
+	if err := s.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	testScan(t, s, []Token{Scalar{Type: String, Data: []byte("b")}, ArrayEnd{}})
+}
+
+func TestXMLDecodeGzipStream(t *testing.T) {
+	f, err := os.Open("testdata/bench.xml.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got testElement
+	if err := NewXMLDecoder(iotest.HalfReader(gz)).Unmarshal(&got); err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(got, testElement{}) {
+		t.Fatal("Expected element decoded from stream")
+	}
+
+	// Offsets are of the uncompressed stream
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><array><integer>1</integer></map></llsd>`
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	_, _ = zw.Write([]byte(xml))
+	_ = zw.Close()
+	gz, err = gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v any
+	err = NewXMLDecoder(gz).Unmarshal(&v)
+	var invalid *InvalidLLSDError
+	if !errors.As(err, &invalid) || invalid.Offset != int64(strings.Index(xml, "</map>")+len("</map>")) {
+		t.Fatalf("Expected InvalidLLSDError at the end of </map> but got %v", err)
+	}
+}
+
+type regionName string
+
+func TestXMLUnmarshalNamedKeyMap(t *testing.T) {
+	var dst map[regionName]int
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>Ahern</key><integer>1</integer><key>Bonifacio</key><integer>2</integer></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[regionName]int{"Ahern": 1, "Bonifacio": 2}
+	if !reflect.DeepEqual(dst, expected) {
+		t.Fatalf("Expected %v but got %v", expected, dst)
+	}
+}
+
+func TestXMLUnmarshalTypeConstraint(t *testing.T) {
+	var dst struct {
+		Token string `llsd:"token,type=string"`
+		Count *int   `llsd:"count,type=integer"`
+		Value any    `llsd:"value,type=string"`
+	}
+	xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>token</key><string>abc</string><key>count</key><integer>2</integer></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Token != "abc" || dst.Count == nil || *dst.Count != 2 {
+		t.Fatalf("Expected token abc and count 2 but got %v, %v", dst.Token, dst.Count)
+	}
+
+	for _, c := range []struct {
+		value string
+		err   string
+	}{
+		{`<key>token</key><binary>616263</binary>`, "Cannot unmarshal binary into Go struct field token"},
+		{`<key>token</key><integer>1</integer>`, "Cannot unmarshal integer into Go struct field token"},
+		{`<key>count</key><real>2.0</real>`, "Cannot unmarshal real into Go struct field count"},
+		{`<key>count</key><undef />`, "Cannot unmarshal undef into Go struct field count"},
+		{`<key>value</key><map><key>a</key><string>b</string></map>`, "Cannot unmarshal map into Go struct field value"},
+		{`<key>value</key><array><string>b</string></array>`, "Cannot unmarshal array into Go struct field value"},
+	} {
+		xml := `<?xml version="1.0" encoding="UTF-8"?><llsd><map>` + c.value + `</map></llsd>`
+		err := UnmarshalXML([]byte(xml), &dst)
+		var typeErr *UnmarshalTypeError
+		if !errors.As(err, &typeErr) || !errorContains(err, c.err) || typeErr.Offset == 0 {
+			t.Fatalf("%s: expected %q with offset but got %v", c.value, c.err, err)
+		}
+	}
+
+	var misspelled struct {
+		Token string `llsd:"token,type=strng"`
+	}
+	xml = `<?xml version="1.0" encoding="UTF-8"?><llsd><map><key>token</key><string>abc</string></map></llsd>`
+	if err := UnmarshalXML([]byte(xml), &misspelled); !errorContains(err, `Unknown LLSD type "strng"`) {
+		t.Fatalf("Expected unknown type error but got %v", err)
+	}
+}